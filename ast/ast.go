@@ -1,6 +1,10 @@
 package ast
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/kyleconroy/pb/token"
 )
 
@@ -9,6 +13,7 @@ type syntax int
 const (
 	Proto2 syntax = iota
 	Proto3
+	Editions
 )
 
 type Node interface {
@@ -16,17 +21,32 @@ type Node interface {
 	End() token.Pos // position of first character immediately after the node
 }
 
+// blockEnd returns the end of a block in braces. A block that isn't closed,
+// because the input ended first, ends with its last node or else with its
+// opening brace.
+func blockEnd(opening, closing token.Pos, body []Node) token.Pos {
+	switch {
+	case closing.IsValid():
+		return closing + 1
+	case len(body) > 0:
+		return body[len(body)-1].End()
+	}
+	return opening + 1
+}
+
 type BasicLit struct {
-	Kind  token.Token
-	Value string
+	ValuePos token.Pos   // literal position
+	Kind     token.Token // token.INT, token.FLOAT, token.STRING or token.BOOL
+	Value    string      // literal string; e.g. 42, "foo", true, - 1
+	Decoded  string      // decoded value of a token.STRING literal, e.g. foo; or the number with its sign, e.g. -1
 }
 
 func (bs *BasicLit) Pos() token.Pos {
-	return token.Pos(0)
+	return bs.ValuePos
 }
 
 func (bs *BasicLit) End() token.Pos {
-	return token.Pos(0)
+	return token.Pos(int(bs.ValuePos) + len(bs.Value))
 }
 
 type BlockStmt struct {
@@ -40,7 +60,72 @@ func (s *BlockStmt) Pos() token.Pos {
 }
 
 func (s *BlockStmt) End() token.Pos {
-	return s.Closing
+	return blockEnd(s.Opening, s.Closing, s.List)
+}
+
+// A Comment node represents a single //-style or /*-style comment.
+type Comment struct {
+	Slash token.Pos // position of "/" starting the comment
+	Text  string    // comment text (excluding '\n' for //-style comments)
+}
+
+func (c *Comment) Pos() token.Pos {
+	return c.Slash
+}
+
+func (c *Comment) End() token.Pos {
+	return token.Pos(int(c.Slash) + len(c.Text))
+}
+
+// A CommentGroup represents a sequence of comments
+// with no other tokens and no empty lines between.
+type CommentGroup struct {
+	List []*Comment // len(List) > 0
+}
+
+func (g *CommentGroup) Pos() token.Pos {
+	return g.List[0].Pos()
+}
+
+func (g *CommentGroup) End() token.Pos {
+	return g.List[len(g.List)-1].End()
+}
+
+// Text returns the text of the comment without the comment markers and
+// without leading and trailing blank lines. Leading asterisks of block
+// comment lines are removed.
+func (g *CommentGroup) Text() string {
+	if g == nil {
+		return ""
+	}
+	var lines []string
+	for _, c := range g.List {
+		text := c.Text
+		block := strings.HasPrefix(text, "/*")
+		if block {
+			text = strings.TrimSuffix(text[2:], "*/")
+		} else {
+			text = strings.TrimPrefix(text, "//")
+		}
+		for _, l := range strings.Split(text, "\n") {
+			if block {
+				l = strings.TrimLeft(l, " \t")
+				l = strings.TrimPrefix(l, "*")
+			}
+			lines = append(lines, strings.TrimRight(strings.TrimPrefix(l, " "), " \t\r"))
+		}
+	}
+
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
 }
 
 type EmptyStmt struct {
@@ -48,37 +133,83 @@ type EmptyStmt struct {
 }
 
 func (e *EmptyStmt) Pos() token.Pos {
-	return token.Pos(0)
+	return e.Semicolon
 }
 
 func (e *EmptyStmt) End() token.Pos {
-	return token.Pos(0)
+	return e.Semicolon + 1
 }
 
 type Enum struct {
-	Name *Ident
-	Body []Node
+	Detached []*CommentGroup // detached comments; or nil
+	Doc      *CommentGroup   // associated documentation; or nil
+	Enum     token.Pos       // position of "enum" keyword
+	Name     *Ident
+	Opening  token.Pos // position of "{"
+	Body     []Node
+	Closing  token.Pos     // position of "}"; or NoPos if missing
+	Comment  *CommentGroup // line comments; or nil
 }
 
 func (e *Enum) Pos() token.Pos {
-	return token.Pos(0)
+	return e.Enum
 }
 
 func (e *Enum) End() token.Pos {
-	return token.Pos(0)
+	return blockEnd(e.Opening, e.Closing, e.Body)
 }
 
 type EnumField struct {
-	Name  *Ident
-	Value string
+	Detached  []*CommentGroup // detached comments; or nil
+	Doc       *CommentGroup   // associated documentation; or nil
+	Name      *Ident
+	ValuePos  token.Pos // position of the value, or of its sign
+	Value     string    // number with its sign, e.g. -1
+	Options   []*Option
+	Semicolon token.Pos     // position of ";"
+	Comment   *CommentGroup // line comments; or nil
 }
 
 func (e *EnumField) Pos() token.Pos {
-	return token.Pos(0)
+	if e.Name != nil {
+		return e.Name.Pos()
+	}
+	return e.ValuePos
 }
 
 func (e *EnumField) End() token.Pos {
-	return token.Pos(0)
+	return e.Semicolon + 1
+}
+
+type Extend struct {
+	Extend  token.Pos // position of "extend" keyword
+	Type    Node      // *Ident or *FullIdent of the extended message
+	Opening token.Pos // position of "{"
+	Body    []Node
+	Closing token.Pos // position of "}"; or NoPos if missing
+}
+
+func (e *Extend) Pos() token.Pos {
+	return e.Extend
+}
+
+func (e *Extend) End() token.Pos {
+	return blockEnd(e.Opening, e.Closing, e.Body)
+}
+
+type Extensions struct {
+	Extensions token.Pos // position of "extensions" keyword
+	Ranges     []*Range
+	Options    []*Option
+	Semicolon  token.Pos // position of ";"
+}
+
+func (e *Extensions) Pos() token.Pos {
+	return e.Extensions
+}
+
+func (e *Extensions) End() token.Pos {
+	return e.Semicolon + 1
 }
 
 type Expr struct {
@@ -92,30 +223,141 @@ func (e *Expr) End() token.Pos {
 	return token.Pos(0)
 }
 
+// A FieldLit is a single field of a MessageLit, such as get: "/v1/x".
+// Extension names are enclosed in brackets, as are the type names of
+// expanded Any values, such as [type.googleapis.com/pkg.Msg].
+type FieldLit struct {
+	Lbrack    token.Pos // position of "[", if Extension
+	Prefix    string    // URL prefix of an Any type name, e.g. type.googleapis.com; or empty
+	Name      Node      // *Ident or *FullIdent
+	Rbrack    token.Pos // position of "]", if Extension
+	Extension bool
+	Colon     token.Pos // position of ":", if any
+	Value     Node      // *BasicLit, *Ident, *MessageLit or *ListLit
+}
+
+func (f *FieldLit) Pos() token.Pos {
+	if f.Extension {
+		return f.Lbrack
+	}
+	return f.Name.Pos()
+}
+
+func (f *FieldLit) End() token.Pos {
+	return f.Value.End()
+}
+
 type File struct {
-	Syntax syntax
-	Nodes  []Node
+	FileStart token.Pos // start of entire file
+	FileEnd   token.Pos // end of entire file
+	Syntax    syntax
+	Edition   string // edition name, e.g. 2023; set if Syntax is Editions
+	Nodes     []Node
+	Comments  []*CommentGroup // list of all comments in the source file
 }
 
 func (f *File) Pos() token.Pos {
-	return token.Pos(0)
+	return f.FileStart
 }
 
 func (f *File) End() token.Pos {
-	return token.Pos(0)
+	return f.FileEnd
+}
+
+// Package returns the package statement of the file, or nil if the file
+// does not declare a package.
+func (f *File) Package() *Package {
+	for _, n := range f.Nodes {
+		if p, ok := n.(*Package); ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// PackageName returns the dotted name of the declared package, or the
+// empty string if the file does not declare a package.
+func (f *File) PackageName() string {
+	if p := f.Package(); p != nil && p.Name != nil {
+		return p.Name.(fmt.Stringer).String()
+	}
+	return ""
+}
+
+// A FullIdent is a qualified name made of dotted parts, such as
+// google.protobuf.Timestamp. A name with a leading dot, such as .foo.Bar,
+// is fully qualified and resolved from the outermost scope.
+type FullIdent struct {
+	Dot      token.Pos // position of leading ".", if Absolute
+	Parts    []*Ident
+	Absolute bool
+}
+
+func (f *FullIdent) Pos() token.Pos {
+	if f.Absolute || len(f.Parts) == 0 {
+		return f.Dot
+	}
+	return f.Parts[0].Pos()
+}
+
+func (f *FullIdent) End() token.Pos {
+	if len(f.Parts) == 0 {
+		return f.Dot + 1
+	}
+	return f.Parts[len(f.Parts)-1].End()
+}
+
+// String returns the name as written in the source, e.g. .foo.Bar.
+func (f *FullIdent) String() string {
+	parts := make([]string, len(f.Parts))
+	for i, p := range f.Parts {
+		parts[i] = p.Name
+	}
+	name := strings.Join(parts, ".")
+	if f.Absolute {
+		return "." + name
+	}
+	return name
+}
+
+type Group struct {
+	Detached []*CommentGroup // detached comments; or nil
+	Doc      *CommentGroup   // associated documentation; or nil
+	Label    *Ident          // "optional", "required", "repeated" or nil
+	Group    token.Pos       // position of "group" keyword
+	Name     *Ident
+	Number   *BasicLit
+	Options  []*Option
+	Opening  token.Pos // position of "{"
+	Body     []Node
+	Closing  token.Pos     // position of "}"; or NoPos if missing
+	Comment  *CommentGroup // line comments; or nil
+}
+
+func (g *Group) Pos() token.Pos {
+	if g.Label != nil {
+		return g.Label.Pos()
+	}
+	return g.Group
+}
+
+func (g *Group) End() token.Pos {
+	return blockEnd(g.Opening, g.Closing, g.Body)
 }
 
 type Import struct {
+	Import    token.Pos // position of "import" keyword
 	Modifiers []*Ident
 	Path      *BasicLit
+	Semicolon token.Pos // position of ";"
 }
 
 func (i *Import) Pos() token.Pos {
-	return token.Pos(0)
+	return i.Import
 }
 
 func (i *Import) End() token.Pos {
-	return token.Pos(0)
+	return i.Semicolon + 1
 }
 
 type Ident struct {
@@ -124,118 +366,289 @@ type Ident struct {
 }
 
 func (i *Ident) Pos() token.Pos {
-	return token.Pos(0)
+	return i.NamePos
 }
 
 func (i *Ident) End() token.Pos {
-	return token.Pos(0)
+	return token.Pos(int(i.NamePos) + len(i.Name))
+}
+
+func (i *Ident) String() string {
+	return i.Name
+}
+
+// A ListLit is a list of values in a MessageLit, such as [1, 2, 3].
+type ListLit struct {
+	Opening token.Pos // position of "["
+	Values  []Node
+	Closing token.Pos // position of "]"
+}
+
+func (l *ListLit) Pos() token.Pos {
+	return l.Opening
+}
+
+func (l *ListLit) End() token.Pos {
+	return l.Closing + 1
 }
 
 type MapType struct {
-	Map   token.Pos // position of "map" keyword
-	Key   *Ident
-	Value *Ident
+	Map     token.Pos // position of "map" keyword
+	Key     *Ident
+	Value   Node      // *Ident or *FullIdent
+	Closing token.Pos // position of ">"
 }
 
 func (m *MapType) Pos() token.Pos {
-	return token.Pos(0)
+	return m.Map
 }
 
 func (m *MapType) End() token.Pos {
-	return token.Pos(0)
+	return m.Closing + 1
 }
 
 type Message struct {
-	Name *Ident
-	Body []Node
+	Detached []*CommentGroup // detached comments; or nil
+	Doc      *CommentGroup   // associated documentation; or nil
+	Message  token.Pos       // position of "message" keyword
+	Name     *Ident
+	Opening  token.Pos // position of "{"
+	Body     []Node
+	Closing  token.Pos     // position of "}"; or NoPos if missing
+	Comment  *CommentGroup // line comments; or nil
 }
 
 func (m *Message) Pos() token.Pos {
-	return token.Pos(0)
+	return m.Message
 }
 
 func (m *Message) End() token.Pos {
-	return token.Pos(0)
+	return blockEnd(m.Opening, m.Closing, m.Body)
 }
 
 type MessageField struct {
-	Name     *Ident
-	Number   *BasicLit
-	Type     Node
-	Repeated *Ident
+	Detached  []*CommentGroup // detached comments; or nil
+	Doc       *CommentGroup   // associated documentation; or nil
+	Name      *Ident
+	Number    *BasicLit
+	Type      Node   // *Ident, *FullIdent or *MapType
+	Label     *Ident // "optional", "required", "repeated" or nil
+	Default   Node   // *BasicLit or *Ident; or nil
+	Options   []*Option
+	Semicolon token.Pos     // position of ";"
+	Comment   *CommentGroup // line comments; or nil
 }
 
 func (m *MessageField) Pos() token.Pos {
-	return token.Pos(0)
+	if m.Label != nil {
+		return m.Label.Pos()
+	}
+	if m.Type != nil {
+		return m.Type.Pos()
+	}
+	return m.Name.Pos()
 }
 
 func (m *MessageField) End() token.Pos {
-	return token.Pos(0)
+	return m.Semicolon + 1
+}
+
+// A MessageLit is an aggregate option value written in the protobuf text
+// format, such as { get: "/v1/x" body: "*" }.
+type MessageLit struct {
+	Opening token.Pos // position of "{" or "<"
+	Fields  []*FieldLit
+	Closing token.Pos // position of "}" or ">"
+}
+
+func (m *MessageLit) Pos() token.Pos {
+	return m.Opening
+}
+
+func (m *MessageLit) End() token.Pos {
+	return m.Closing + 1
 }
 
 type OneOf struct {
-	Name  *Ident
-	Body  []Node
-	OneOf token.Pos // position of "oneof" keyword
+	Detached []*CommentGroup // detached comments; or nil
+	Doc      *CommentGroup   // associated documentation; or nil
+	Name     *Ident
+	Body     []Node
+	OneOf    token.Pos     // position of "oneof" keyword
+	Opening  token.Pos     // position of "{"
+	Closing  token.Pos     // position of "}"; or NoPos if missing
+	Comment  *CommentGroup // line comments; or nil
 }
 
 func (oo *OneOf) Pos() token.Pos {
-	return token.Pos(0)
+	return oo.OneOf
 }
 
 func (oo *OneOf) End() token.Pos {
-	return token.Pos(0)
+	return blockEnd(oo.Opening, oo.Closing, oo.Body)
 }
 
 type Option struct {
-	Names    []*Ident
-	Constant *BasicLit
+	Option    token.Pos // position of "option" keyword, if any
+	Names     []*OptionName
+	Constant  Node      // *BasicLit, *Ident or *MessageLit
+	Semicolon token.Pos // position of ";", if any
 }
 
 func (o *Option) Pos() token.Pos {
-	return token.Pos(0)
+	if o.Option.IsValid() || len(o.Names) == 0 {
+		return o.Option
+	}
+	return o.Names[0].Pos()
 }
 
 func (o *Option) End() token.Pos {
-	return token.Pos(0)
+	if o.Semicolon.IsValid() || o.Constant == nil {
+		return o.Semicolon + 1
+	}
+	return o.Constant.End()
+}
+
+// An OptionName is one part of a dotted option name. Extension names, such
+// as the my.ext in (my.ext).sub, are enclosed in parentheses.
+type OptionName struct {
+	Lparen    token.Pos // position of "(", if Extension
+	Name      Node      // *Ident or *FullIdent
+	Rparen    token.Pos // position of ")", if Extension
+	Extension bool
+}
+
+func (o *OptionName) Pos() token.Pos {
+	if o.Extension {
+		return o.Lparen
+	}
+	return o.Name.Pos()
+}
+
+func (o *OptionName) End() token.Pos {
+	if o.Extension {
+		return o.Rparen + 1
+	}
+	return o.Name.End()
 }
 
 type Package struct {
+	Package   token.Pos // position of "package" keyword
+	Name      Node      // *Ident or *FullIdent
+	Semicolon token.Pos // position of ";"
 }
 
 func (p *Package) Pos() token.Pos {
-	return token.Pos(0)
+	return p.Package
 }
 
 func (p *Package) End() token.Pos {
-	return token.Pos(0)
+	return p.Semicolon + 1
+}
+
+// A PackageFiles node represents a set of source files that declare the
+// same proto package.
+type PackageFiles struct {
+	Name  string           // package name, e.g. google.protobuf; or empty
+	Files map[string]*File // map of file names to source files
+}
+
+func (p *PackageFiles) Pos() token.Pos {
+	return token.NoPos
+}
+
+func (p *PackageFiles) End() token.Pos {
+	return token.NoPos
+}
+
+// Filenames returns the names of the files in the package in sorted order.
+func (p *PackageFiles) Filenames() []string {
+	names := make([]string, 0, len(p.Files))
+	for name := range p.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// A Range represents a single number or a range of numbers in an
+// extensions or reserved statement.
+type Range struct {
+	Low  *BasicLit
+	To   token.Pos // position of "to" keyword, if any
+	High Node      // *BasicLit, *Ident for "max", or nil
+}
+
+func (r *Range) Pos() token.Pos {
+	return r.Low.Pos()
+}
+
+func (r *Range) End() token.Pos {
+	if r.High != nil {
+		return r.High.End()
+	}
+	return r.Low.End()
+}
+
+type Reserved struct {
+	Reserved  token.Pos // position of "reserved" keyword
+	Ranges    []*Range
+	Names     []Node    // *BasicLit, or *Ident in editions
+	Semicolon token.Pos // position of ";"
+}
+
+func (r *Reserved) Pos() token.Pos {
+	return r.Reserved
+}
+
+func (r *Reserved) End() token.Pos {
+	return r.Semicolon + 1
 }
 
 type RPC struct {
-	RPC     token.Pos
-	Name    *Ident
-	InType  *Ident
-	OutType *Ident
+	Detached        []*CommentGroup // detached comments; or nil
+	Doc             *CommentGroup   // associated documentation; or nil
+	RPC             token.Pos       // position of "rpc" keyword
+	Name            *Ident
+	InType          Node // *Ident or *FullIdent
+	OutType         Node // *Ident or *FullIdent
+	ClientStreaming bool // input type is preceded by "stream"
+	ServerStreaming bool // output type is preceded by "stream"
+	Options         []*Option
+	Closing         token.Pos     // position of ";" or "}"; or NoPos if missing
+	Comment         *CommentGroup // line comments; or nil
 }
 
 func (r *RPC) Pos() token.Pos {
-	return token.Pos(0)
+	return r.RPC
 }
 
 func (r *RPC) End() token.Pos {
-	return token.Pos(0)
+	switch {
+	case r.Closing.IsValid():
+		return r.Closing + 1
+	case len(r.Options) > 0:
+		return r.Options[len(r.Options)-1].End()
+	}
+	return r.OutType.End()
 }
 
 type Service struct {
-	Service token.Pos
-	Name    *Ident
-	Body    *BlockStmt
+	Detached []*CommentGroup // detached comments; or nil
+	Doc      *CommentGroup   // associated documentation; or nil
+	Service  token.Pos       // position of "service" keyword
+	Name     *Ident
+	Body     *BlockStmt
+	Comment  *CommentGroup // line comments; or nil
 }
 
 func (s *Service) Pos() token.Pos {
-	return token.Pos(0)
+	return s.Service
 }
 
 func (s *Service) End() token.Pos {
-	return token.Pos(0)
+	if s.Body != nil {
+		return s.Body.End()
+	}
+	return s.Name.End()
 }
@@ -32,23 +32,108 @@ func Walk(v Visitor, node Node) {
 			Walk(v, m)
 		}
 
-	case *EmptyStmt, *Expr:
+	case *Comment:
+
+	case *CommentGroup:
+		for _, c := range n.List {
+			Walk(v, c)
+		}
+
+	case *EmptyStmt:
 
 	case *Enum:
+		for _, g := range n.Detached {
+			Walk(v, g)
+		}
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
 		for _, m := range n.Body {
 			Walk(v, m)
 		}
+		if n.Comment != nil {
+			Walk(v, n.Comment)
+		}
 
 	case *EnumField:
+		for _, g := range n.Detached {
+			Walk(v, g)
+		}
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
 		if n.Name != nil {
 			Walk(v, n.Name)
 		}
+		for _, m := range n.Options {
+			Walk(v, m)
+		}
+		if n.Comment != nil {
+			Walk(v, n.Comment)
+		}
+
+	case *Extend:
+		if n.Type != nil {
+			Walk(v, n.Type)
+		}
+		for _, m := range n.Body {
+			Walk(v, m)
+		}
+
+	case *Extensions:
+		for _, m := range n.Ranges {
+			Walk(v, m)
+		}
+		for _, m := range n.Options {
+			Walk(v, m)
+		}
+
+	case *Expr:
+
+	case *FieldLit:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
 
 	case *File:
 		for _, m := range n.Nodes {
 			Walk(v, m)
 		}
 
+	case *FullIdent:
+		for _, m := range n.Parts {
+			Walk(v, m)
+		}
+
+	case *Group:
+		for _, g := range n.Detached {
+			Walk(v, g)
+		}
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
+		if n.Label != nil {
+			Walk(v, n.Label)
+		}
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		if n.Number != nil {
+			Walk(v, n.Number)
+		}
+		for _, m := range n.Options {
+			Walk(v, m)
+		}
+		for _, m := range n.Body {
+			Walk(v, m)
+		}
+		if n.Comment != nil {
+			Walk(v, n.Comment)
+		}
+
 	case *Ident:
 
 	case *Import:
@@ -59,6 +144,11 @@ func Walk(v Visitor, node Node) {
 			Walk(v, n.Path)
 		}
 
+	case *ListLit:
+		for _, m := range n.Values {
+			Walk(v, m)
+		}
+
 	case *MapType:
 		if n.Key != nil {
 			Walk(v, n.Key)
@@ -68,14 +158,29 @@ func Walk(v Visitor, node Node) {
 		}
 
 	case *Message:
+		for _, g := range n.Detached {
+			Walk(v, g)
+		}
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
 		if n.Name != nil {
 			Walk(v, n.Name)
 		}
 		for _, m := range n.Body {
 			Walk(v, m)
 		}
+		if n.Comment != nil {
+			Walk(v, n.Comment)
+		}
 
 	case *MessageField:
+		for _, g := range n.Detached {
+			Walk(v, g)
+		}
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
 		if n.Name != nil {
 			Walk(v, n.Name)
 		}
@@ -85,17 +190,40 @@ func Walk(v Visitor, node Node) {
 		if n.Type != nil {
 			Walk(v, n.Type)
 		}
-		if n.Repeated != nil {
-			Walk(v, n.Repeated)
+		if n.Label != nil {
+			Walk(v, n.Label)
+		}
+		if n.Default != nil {
+			Walk(v, n.Default)
+		}
+		for _, m := range n.Options {
+			Walk(v, m)
+		}
+		if n.Comment != nil {
+			Walk(v, n.Comment)
+		}
+
+	case *MessageLit:
+		for _, m := range n.Fields {
+			Walk(v, m)
 		}
 
 	case *OneOf:
+		for _, g := range n.Detached {
+			Walk(v, g)
+		}
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
 		if n.Name != nil {
 			Walk(v, n.Name)
 		}
 		for _, m := range n.Body {
 			Walk(v, m)
 		}
+		if n.Comment != nil {
+			Walk(v, n.Comment)
+		}
 
 	case *Option:
 		for _, m := range n.Names {
@@ -105,10 +233,44 @@ func Walk(v Visitor, node Node) {
 			Walk(v, n.Constant)
 		}
 
+	case *OptionName:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+
 	case *Package:
-		// TODO: Add fields to Package
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+
+	case *PackageFiles:
+		for _, name := range n.Filenames() {
+			Walk(v, n.Files[name])
+		}
+
+	case *Range:
+		if n.Low != nil {
+			Walk(v, n.Low)
+		}
+		if n.High != nil {
+			Walk(v, n.High)
+		}
+
+	case *Reserved:
+		for _, m := range n.Ranges {
+			Walk(v, m)
+		}
+		for _, m := range n.Names {
+			Walk(v, m)
+		}
 
 	case *RPC:
+		for _, g := range n.Detached {
+			Walk(v, g)
+		}
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
 		if n.Name != nil {
 			Walk(v, n.Name)
 		}
@@ -118,14 +280,29 @@ func Walk(v Visitor, node Node) {
 		if n.OutType != nil {
 			Walk(v, n.OutType)
 		}
+		for _, m := range n.Options {
+			Walk(v, m)
+		}
+		if n.Comment != nil {
+			Walk(v, n.Comment)
+		}
 
 	case *Service:
+		for _, g := range n.Detached {
+			Walk(v, g)
+		}
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
 		if n.Name != nil {
 			Walk(v, n.Name)
 		}
 		if n.Body != nil {
 			Walk(v, n.Body)
 		}
+		if n.Comment != nil {
+			Walk(v, n.Comment)
+		}
 
 	default:
 		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
@@ -34,18 +34,31 @@ func walk(t *testing.T, n Node, expected []Node) {
 func TestEmpty(t *testing.T) {
 	for _, n := range []Node{
 		&BasicLit{},
+		&Comment{},
+		&CommentGroup{},
 		&EmptyStmt{},
 		&Enum{},
 		&EnumField{},
 		&Expr{},
+		&Extend{},
+		&Extensions{},
+		&FieldLit{},
 		&File{},
+		&FullIdent{},
+		&Group{},
 		&Ident{},
 		&Import{},
+		&ListLit{},
 		&MapType{},
 		&MessageField{},
+		&MessageLit{},
 		&OneOf{},
 		&Option{},
+		&OptionName{},
 		&Package{},
+		&PackageFiles{},
+		&Range{},
+		&Reserved{},
 		&RPC{},
 		&Service{},
 	} {
@@ -61,14 +74,40 @@ func TestWalkBlockStmt(t *testing.T) {
 	walk(t, b, []Node{b, n, nil, nil})
 }
 
+func TestWalkCommentGroup(t *testing.T) {
+	g := &CommentGroup{List: []*Comment{&Comment{}, &Comment{}}}
+	walk(t, g, []Node{g, g.List[0], nil, g.List[1], nil, nil})
+}
+
+func TestWalkComments(t *testing.T) {
+	d, doc, c := &CommentGroup{}, &CommentGroup{}, &CommentGroup{}
+	m := &MessageField{Detached: []*CommentGroup{d}, Doc: doc, Name: &Ident{}, Comment: c}
+	walk(t, m, []Node{m, d, nil, doc, nil, m.Name, nil, c, nil, nil})
+}
+
 func TestWalkEnum(t *testing.T) {
 	e := &Enum{Name: &Ident{}, Body: []Node{&Ident{}}}
 	walk(t, e, []Node{e, e.Body[0], nil, nil})
 }
 
 func TestWalkEnumField(t *testing.T) {
-	e := &EnumField{Name: &Ident{}}
-	walk(t, e, []Node{e, e.Name, nil, nil})
+	e := &EnumField{Name: &Ident{}, Options: []*Option{&Option{}}}
+	walk(t, e, []Node{e, e.Name, nil, e.Options[0], nil, nil})
+}
+
+func TestWalkExtend(t *testing.T) {
+	e := &Extend{Type: &FullIdent{}, Body: []Node{&MessageField{}}}
+	walk(t, e, []Node{e, e.Type, nil, e.Body[0], nil, nil})
+}
+
+func TestWalkExtensions(t *testing.T) {
+	e := &Extensions{Ranges: []*Range{&Range{}}, Options: []*Option{&Option{}}}
+	walk(t, e, []Node{e, e.Ranges[0], nil, e.Options[0], nil, nil})
+}
+
+func TestWalkFieldLit(t *testing.T) {
+	f := &FieldLit{Name: &Ident{}, Value: &BasicLit{}}
+	walk(t, f, []Node{f, f.Name, nil, f.Value, nil, nil})
 }
 
 func TestWalkFile(t *testing.T) {
@@ -76,19 +115,39 @@ func TestWalkFile(t *testing.T) {
 	walk(t, f, []Node{f, f.Nodes[0], nil, nil})
 }
 
+func TestWalkFullIdent(t *testing.T) {
+	f := &FullIdent{Parts: []*Ident{&Ident{}, &Ident{}}}
+	walk(t, f, []Node{f, f.Parts[0], nil, f.Parts[1], nil, nil})
+}
+
+func TestWalkGroup(t *testing.T) {
+	g := &Group{Label: &Ident{}, Name: &Ident{}, Number: &BasicLit{}, Options: []*Option{&Option{}}, Body: []Node{&Ident{}}}
+	walk(t, g, []Node{g, g.Label, nil, g.Name, nil, g.Number, nil, g.Options[0], nil, g.Body[0], nil, nil})
+}
+
 func TestWalkImport(t *testing.T) {
 	im := &Import{Path: &BasicLit{}, Modifiers: []*Ident{&Ident{}}}
 	walk(t, im, []Node{im, im.Modifiers[0], nil, im.Path, nil, nil})
 }
 
+func TestWalkListLit(t *testing.T) {
+	l := &ListLit{Values: []Node{&BasicLit{}}}
+	walk(t, l, []Node{l, l.Values[0], nil, nil})
+}
+
 func TestWalkMapType(t *testing.T) {
 	m := &MapType{Key: &Ident{}, Value: &Ident{}}
 	walk(t, m, []Node{m, m.Key, nil, m.Value, nil, nil})
 }
 
 func TestWalkMessageField(t *testing.T) {
-	m := &MessageField{Name: &Ident{}, Number: &BasicLit{}, Repeated: &Ident{}, Type: &Ident{}}
-	walk(t, m, []Node{m, m.Name, nil, m.Number, nil, m.Type, nil, m.Repeated, nil, nil})
+	m := &MessageField{Name: &Ident{}, Number: &BasicLit{}, Label: &Ident{}, Type: &Ident{}, Default: &BasicLit{}, Options: []*Option{&Option{}}}
+	walk(t, m, []Node{m, m.Name, nil, m.Number, nil, m.Type, nil, m.Label, nil, m.Default, nil, m.Options[0], nil, nil})
+}
+
+func TestWalkMessageLit(t *testing.T) {
+	m := &MessageLit{Fields: []*FieldLit{&FieldLit{}}}
+	walk(t, m, []Node{m, m.Fields[0], nil, nil})
 }
 
 func TestWalkOneOf(t *testing.T) {
@@ -97,13 +156,38 @@ func TestWalkOneOf(t *testing.T) {
 }
 
 func TestWalkOption(t *testing.T) {
-	o := &Option{Names: []*Ident{&Ident{}}, Constant: &BasicLit{}}
+	o := &Option{Names: []*OptionName{&OptionName{}}, Constant: &BasicLit{}}
 	walk(t, o, []Node{o, o.Names[0], nil, o.Constant, nil, nil})
 }
 
+func TestWalkOptionName(t *testing.T) {
+	o := &OptionName{Name: &Ident{}, Extension: true}
+	walk(t, o, []Node{o, o.Name, nil, nil})
+}
+
+func TestWalkPackage(t *testing.T) {
+	p := &Package{Name: &FullIdent{}}
+	walk(t, p, []Node{p, p.Name, nil, nil})
+}
+
+func TestWalkPackageFiles(t *testing.T) {
+	p := &PackageFiles{Files: map[string]*File{"b.proto": &File{}, "a.proto": &File{}}}
+	walk(t, p, []Node{p, p.Files["a.proto"], nil, p.Files["b.proto"], nil, nil})
+}
+
+func TestWalkRange(t *testing.T) {
+	r := &Range{Low: &BasicLit{}, High: &Ident{}}
+	walk(t, r, []Node{r, r.Low, nil, r.High, nil, nil})
+}
+
+func TestWalkReserved(t *testing.T) {
+	r := &Reserved{Ranges: []*Range{&Range{}}, Names: []Node{&BasicLit{}}}
+	walk(t, r, []Node{r, r.Ranges[0], nil, r.Names[0], nil, nil})
+}
+
 func TestWalkRPC(t *testing.T) {
-	r := &RPC{Name: &Ident{}, InType: &Ident{}, OutType: &Ident{}}
-	walk(t, r, []Node{r, r.Name, nil, r.InType, nil, r.OutType, nil, nil})
+	r := &RPC{Name: &Ident{}, InType: &Ident{}, OutType: &Ident{}, Options: []*Option{&Option{}}}
+	walk(t, r, []Node{r, r.Name, nil, r.InType, nil, r.OutType, nil, r.Options[0], nil, nil})
 }
 
 func TestWalkService(t *testing.T) {
@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/kyleconroy/pb/lint"
+	"github.com/kyleconroy/pb/parser"
+	"github.com/kyleconroy/pb/token"
 )
 
 func main() {
@@ -15,7 +19,14 @@ func main() {
 	log.SetFlags(0)
 
 	for _, file := range flag.Args() {
-		// TODO: Support diretories
+		info, err := os.Stat(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if info.IsDir() {
+			lintDir(file)
+			continue
+		}
 		blob, err := ioutil.ReadFile(file)
 		if err != nil {
 			log.Fatal(err)
@@ -23,11 +34,37 @@ func main() {
 		path := filepath.Base(file)
 		problems, err := lint.Lint(path, blob)
 		if err != nil {
-			log.Fatal(err)
+			parser.PrintError(os.Stderr, err)
+			os.Exit(1)
 		}
+		printProblems(problems)
+	}
+}
 
-		for _, p := range problems {
-			fmt.Printf("%s:%d %s\n", path, 0, p.Text)
+// lintDir lints every proto file in the directory tree rooted at dir.
+func lintDir(dir string) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, parser.ParseConcurrently)
+	if err != nil {
+		parser.PrintError(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	names := make([]string, 0, len(pkgs))
+	for name := range pkgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pkg := pkgs[name]
+		for _, filename := range pkg.Filenames() {
+			printProblems(lint.LintFile(fset, pkg.Files[filename]))
 		}
 	}
 }
+
+func printProblems(problems []lint.Problem) {
+	for _, p := range problems {
+		fmt.Printf("%s %s\n", p.Position, p.Text)
+	}
+}
@@ -0,0 +1,216 @@
+// Package importer resolves the imports of proto files against a list of
+// include paths, like the -I flag of protoc, and parses every file they
+// transitively depend on.
+package importer
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kyleconroy/pb/ast"
+	"github.com/kyleconroy/pb/parser"
+	"github.com/kyleconroy/pb/token"
+	"github.com/kyleconroy/pb/wellknown"
+)
+
+// A File is a parsed proto file together with its resolved imports.
+type File struct {
+	Path     string    // import path, relative to its include path
+	Filename string    // name of the file on disk, or Path if builtin
+	AST      *ast.File // parsed file
+	Imports  []*File   // resolved imports, in source order
+	Public   []*File   // imports re-exported with "import public"
+
+	errors parser.ErrorList // errors found while loading the file
+}
+
+// Visible returns the files whose definitions f may refer to: its direct
+// imports and, transitively, the files they re-export with import public.
+func (f *File) Visible() []*File {
+	var files []*File
+	seen := map[*File]bool{}
+	var add func(*File)
+	add = func(dep *File) {
+		if seen[dep] {
+			return
+		}
+		seen[dep] = true
+		files = append(files, dep)
+		for _, pub := range dep.Public {
+			add(pub)
+		}
+	}
+	for _, dep := range f.Imports {
+		add(dep)
+	}
+	return files
+}
+
+// An Importer parses proto files and everything they import. Files are
+// parsed once and shared between all files that import them.
+//
+// Imports that aren't found in the include paths are looked up in
+// Builtin, which holds the well-known types of package wellknown unless
+// set otherwise. Files in the include paths take precedence.
+type Importer struct {
+	Fset    *token.FileSet
+	Paths   []string    // include paths, searched in order; "." if empty
+	Mode    parser.Mode // mode passed to parser.ParseFile
+	Builtin fs.FS       // files searched after the include paths; or nil
+
+	files map[string]*File // parsed files by import path
+	stack []string         // import paths currently being imported
+}
+
+// New returns an Importer that searches the given include paths and
+// records position information in fset.
+func New(fset *token.FileSet, paths []string, mode parser.Mode) *Importer {
+	return &Importer{Fset: fset, Paths: paths, Mode: mode, Builtin: wellknown.FS}
+}
+
+// Import parses the files with the given import paths and all the files
+// they import, transitively. It returns the full set of files, each file
+// following the files it depends on.
+//
+// If one of the given paths can't be found, Import returns a nil slice and
+// the error. Syntax errors, missing imports and import cycles are reported
+// together as a parser.ErrorList, next to the files that could be parsed.
+// A weak import that can't be found is ignored. Errors are reported again
+// every time a file that has them is returned.
+func (imp *Importer) Import(paths ...string) ([]*File, error) {
+	if imp.files == nil {
+		imp.files = map[string]*File{}
+	}
+
+	var files []*File
+	var errors parser.ErrorList
+	seen := map[*File]bool{}
+	var add func(*File)
+	add = func(f *File) {
+		if seen[f] {
+			return
+		}
+		seen[f] = true
+		for _, dep := range f.Imports {
+			add(dep)
+		}
+		files = append(files, f)
+		errors = append(errors, f.errors...)
+	}
+
+	for _, path := range paths {
+		if f, ok := imp.files[path]; ok {
+			add(f)
+			continue
+		}
+		filename, src, err := imp.open(path)
+		if err != nil {
+			return nil, err
+		}
+		add(imp.load(path, filename, src))
+	}
+	errors.Sort()
+	return files, errors.Err()
+}
+
+// open opens the file with the given import path in the first include
+// path that contains it, or else in the builtin files. Builtin files are
+// named by their import path. Like protoc, open rejects paths that are
+// absolute or contain . or .. elements, so that imports can't reach files
+// outside the include paths.
+func (imp *Importer) open(path string) (string, io.ReadCloser, error) {
+	if !fs.ValidPath(path) {
+		return "", nil, fmt.Errorf("%s: invalid import path, must be relative without . or .. elements", path)
+	}
+	roots := imp.Paths
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	for _, root := range roots {
+		filename := filepath.Join(root, filepath.FromSlash(path))
+		if info, err := os.Stat(filename); err == nil && !info.IsDir() {
+			src, err := os.Open(filename)
+			return filename, src, err
+		}
+	}
+	if imp.Builtin != nil {
+		if info, err := fs.Stat(imp.Builtin, path); err == nil && !info.IsDir() {
+			src, err := imp.Builtin.Open(path)
+			return path, src, err
+		}
+	}
+	return "", nil, fmt.Errorf("%s: file not found in include paths %s", path, strings.Join(roots, ", "))
+}
+
+// load parses the file read from src and resolves its imports.
+func (imp *Importer) load(path, filename string, src io.ReadCloser) *File {
+	f := &File{Path: path, Filename: filename}
+	imp.files[path] = f
+	var err error
+	f.AST, err = parser.ParseFile(imp.Fset, filename, src, imp.Mode)
+	src.Close()
+	if list, ok := err.(parser.ErrorList); ok {
+		f.errors = append(f.errors, list...)
+	} else if err != nil {
+		f.errors.Add(token.Position{Filename: filename}, err.Error())
+	}
+	if f.AST == nil {
+		return f
+	}
+
+	imp.stack = append(imp.stack, path)
+	for _, node := range f.AST.Nodes {
+		stmt, ok := node.(*ast.Import)
+		if !ok || stmt.Path == nil {
+			continue
+		}
+		if dep := imp.resolve(f, stmt); dep != nil {
+			f.Imports = append(f.Imports, dep)
+			if hasModifier(stmt, "public") {
+				f.Public = append(f.Public, dep)
+			}
+		}
+	}
+	imp.stack = imp.stack[:len(imp.stack)-1]
+	return f
+}
+
+// resolve finds and loads the file named by an import statement of f. It
+// records an error in f and returns nil if the import can't be resolved.
+func (imp *Importer) resolve(f *File, stmt *ast.Import) *File {
+	path := stmt.Path.Decoded
+	pos := imp.Fset.Position(stmt.Path.Pos())
+	for i, p := range imp.stack {
+		if p == path {
+			chain := append(imp.stack[i:len(imp.stack):len(imp.stack)], path)
+			f.errors.Add(pos, "import cycle not allowed: "+strings.Join(chain, " -> "))
+			return nil
+		}
+	}
+	if dep, ok := imp.files[path]; ok {
+		return dep
+	}
+	filename, src, err := imp.open(path)
+	if err != nil {
+		// A weak import may be missing, but its path must be valid
+		if !hasModifier(stmt, "weak") || !fs.ValidPath(path) {
+			f.errors.Add(pos, err.Error())
+		}
+		return nil
+	}
+	return imp.load(path, filename, src)
+}
+
+// hasModifier reports whether the import statement has the given modifier.
+func hasModifier(stmt *ast.Import, name string) bool {
+	for _, m := range stmt.Modifiers {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package importer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kyleconroy/pb/parser"
+	"github.com/kyleconroy/pb/token"
+)
+
+// writeTree writes the given files below a new temporary directory and
+// returns its name.
+func writeTree(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "importer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, src := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func paths(files []*File) string {
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Path)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestImport(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"src/app/app.proto": `syntax = "proto3";
+import "app/model.proto";
+import "lib/common.proto";
+import weak "lib/missing.proto";`,
+		"src/app/model.proto": `syntax = "proto3";
+import public "lib/common.proto";`,
+		"vendor/lib/common.proto": `syntax = "proto3";
+import public "lib/base.proto";`,
+		"vendor/lib/base.proto": `syntax = "proto3";`,
+		"src/lib/base.proto":    `this file is shadowed by vendor`,
+	})
+	defer os.RemoveAll(dir)
+
+	imp := New(token.NewFileSet(), []string{filepath.Join(dir, "vendor"), filepath.Join(dir, "src")}, 0)
+	files, err := imp.Import("app/app.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := paths(files); p != "lib/base.proto lib/common.proto app/model.proto app/app.proto" {
+		t.Errorf("unexpected files in dependency order: %s", p)
+	}
+
+	app := files[3]
+	if p := paths(app.Imports); p != "app/model.proto lib/common.proto" {
+		t.Errorf("unexpected imports: %s", p)
+	}
+	if p := paths(app.Visible()); p != "app/model.proto lib/common.proto lib/base.proto" {
+		t.Errorf("unexpected visible files: %s", p)
+	}
+	if p := paths(files[2].Public); p != "lib/common.proto" {
+		t.Errorf("unexpected public imports: %s", p)
+	}
+	if files[0].Filename != filepath.Join(dir, "vendor", "lib", "base.proto") {
+		t.Errorf("expected base.proto from the first include path, got %s", files[0].Filename)
+	}
+
+	// Files are shared between imports
+	if files[1].Imports[0] != files[0] || app.Imports[1] != files[1] {
+		t.Error("expected imported files to be shared")
+	}
+}
+
+func TestImportWellKnown(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"event.proto": `syntax = "proto3";
+import "google/protobuf/timestamp.proto";
+import "google/protobuf/empty.proto";`,
+		"google/protobuf/empty.proto": `syntax = "proto3";
+package local;`,
+	})
+	defer os.RemoveAll(dir)
+
+	imp := New(token.NewFileSet(), []string{dir}, 0)
+	files, err := imp.Import("event.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := paths(files); p != "google/protobuf/timestamp.proto google/protobuf/empty.proto event.proto" {
+		t.Fatalf("unexpected files: %s", p)
+	}
+	if files[0].Filename != "google/protobuf/timestamp.proto" {
+		t.Errorf("expected the embedded timestamp.proto, got %s", files[0].Filename)
+	}
+	if files[1].Filename != filepath.Join(dir, "google", "protobuf", "empty.proto") {
+		t.Errorf("expected empty.proto from the include path, got %s", files[1].Filename)
+	}
+
+	// Option definitions and plugins import the descriptor types
+	files, err = imp.Import("google/protobuf/compiler/plugin.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := paths(files); p != "google/protobuf/descriptor.proto google/protobuf/compiler/plugin.proto" {
+		t.Errorf("unexpected files: %s", p)
+	}
+
+	imp = New(token.NewFileSet(), []string{dir}, 0)
+	imp.Builtin = nil
+	if _, err := imp.Import("event.proto"); err == nil {
+		t.Error("expected an error without builtin files")
+	}
+	// Directories of the builtin files can't be imported
+	dir = writeTree(t, map[string]string{
+		"dir.proto": `import "google/protobuf";`,
+	})
+	defer os.RemoveAll(dir)
+	imp = New(token.NewFileSet(), []string{dir}, 0)
+	for _, path := range []string{"dir.proto", "google/protobuf"} {
+		if _, err := imp.Import(path); err == nil || !strings.Contains(err.Error(), "google/protobuf: file not found") {
+			t.Errorf("%s: expected google/protobuf not to be found, got %v", path, err)
+		}
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"a.proto": `import "b.proto";
+import "missing.proto";`,
+		"b.proto": `import "c.proto";`,
+		"c.proto": `import "a.proto";
+message {}`,
+	})
+	defer os.RemoveAll(dir)
+
+	imp := New(token.NewFileSet(), []string{dir}, 0)
+	files, err := imp.Import("a.proto")
+	list, ok := err.(parser.ErrorList)
+	if !ok {
+		t.Fatalf("expected an ErrorList, got %v", err)
+	}
+	var msgs []string
+	for _, e := range list {
+		msgs = append(msgs, e.Error())
+	}
+	expected := []string{
+		filepath.Join(dir, "a.proto") + ":2:8: missing.proto: file not found in include paths " + dir,
+		filepath.Join(dir, "c.proto") + ":1:8: import cycle not allowed: a.proto -> b.proto -> c.proto -> a.proto",
+		filepath.Join(dir, "c.proto") + ":2:9: expected ident, found \"{\"",
+	}
+	if strings.Join(msgs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(msgs, "\n"))
+	}
+	if p := paths(files); p != "c.proto b.proto a.proto" {
+		t.Errorf("unexpected files: %s", p)
+	}
+
+	// Files loaded by an earlier call report their errors again
+	for path, n := range map[string]int{"a.proto": 3, "b.proto": 2} {
+		_, err := imp.Import(path)
+		if list, ok := err.(parser.ErrorList); !ok || len(list) != n {
+			t.Errorf("%s: expected %d errors, got %v", path, n, err)
+		}
+	}
+
+	if _, err := imp.Import("nothere.proto"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestImportOutsidePaths(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"secret.proto": `message Secret {}`,
+		"include/a.proto": `import "../secret.proto";
+import weak "./secret.proto";
+import "/secret.proto";`,
+	})
+	defer os.RemoveAll(dir)
+
+	imp := New(token.NewFileSet(), []string{filepath.Join(dir, "include")}, 0)
+	files, err := imp.Import("a.proto")
+	list, ok := err.(parser.ErrorList)
+	if !ok || len(list) != 3 {
+		t.Fatalf("expected 3 errors, got %v", err)
+	}
+	for i, e := range list {
+		if e.Pos.Line != i+1 || !strings.Contains(e.Msg, "invalid import path") {
+			t.Errorf("expected an invalid import path on line %d, got %s", i+1, e)
+		}
+	}
+	if p := paths(files); p != "a.proto" {
+		t.Errorf("unexpected files: %s", p)
+	}
+
+	if _, err := imp.Import("../secret.proto"); err == nil {
+		t.Error("expected an error for a path outside the include paths")
+	}
+}
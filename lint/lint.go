@@ -18,12 +18,12 @@ type Linter struct {
 
 // Problem represents a problem in some source code.
 type Problem struct {
-	Position   token.Pos // position in source file
-	Text       string    // the prose that describes the problem
-	Link       string    // (optional) the link to the style guide for the problem
-	Confidence float64   // a value in (0,1] estimating the confidence in this problem's correctness
-	LineText   string    // the source line
-	Category   string    // a short name for the general category of the problem
+	Position   token.Position // position in source file
+	Text       string         // the prose that describes the problem
+	Link       string         // (optional) the link to the style guide for the problem
+	Confidence float64        // a value in (0,1] estimating the confidence in this problem's correctness
+	LineText   string         // the source line
+	Category   string         // a short name for the general category of the problem
 }
 
 func Lint(filename string, src []byte) ([]Problem, error) {
@@ -34,6 +34,7 @@ func Lint(filename string, src []byte) ([]Problem, error) {
 		return nil, err
 	}
 	h := file{
+		fset:     fset,
 		f:        f,
 		src:      src,
 		filename: filename,
@@ -42,8 +43,21 @@ func Lint(filename string, src []byte) ([]Problem, error) {
 	return h.problems, nil
 }
 
+// LintFile lints a file that has already been parsed, for example by
+// parser.ParseDir. Positions of the problems are resolved through fset.
+func LintFile(fset *token.FileSet, f *ast.File) []Problem {
+	h := file{
+		fset:     fset,
+		f:        f,
+		filename: fset.Position(f.Pos()).Filename,
+	}
+	h.lint()
+	return h.problems
+}
+
 // file represents a protocol buffer file being linted.
 type file struct {
+	fset     *token.FileSet
 	f        *ast.File
 	src      []byte
 	filename string
@@ -75,8 +89,9 @@ func (w walker) Visit(node ast.Node) ast.Visitor {
 // It returns the new Problem.
 func (f *file) errorf(n ast.Node, confidence float64, msg string, args ...interface{}) {
 	f.problems = append(f.problems, Problem{
-		Position: n.Pos(),
-		Text:     fmt.Sprintf(msg, args...),
+		Position:   f.fset.Position(n.Pos()),
+		Text:       fmt.Sprintf(msg, args...),
+		Confidence: confidence,
 	})
 }
 
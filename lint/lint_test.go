@@ -1,6 +1,12 @@
 package lint
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"github.com/kyleconroy/pb/parser"
+	"github.com/kyleconroy/pb/token"
+)
 
 const sloppyEnum = `
 syntax = "proto3";
@@ -22,3 +28,31 @@ func TestEnumLint(t *testing.T) {
 	}
 	t.Log(problems)
 }
+
+func TestProblemPosition(t *testing.T) {
+	problems, err := Lint("sloppy.proto", []byte(sloppyEnum))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) == 0 {
+		t.Fatal("expected problems")
+	}
+	if pos := problems[0].Position.String(); pos != "sloppy.proto:6:1" {
+		t.Errorf("expected position sloppy.proto:6:1, got %s", pos)
+	}
+}
+
+func TestLintFile(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "sloppy.proto", strings.NewReader(sloppyEnum), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := LintFile(fset, f)
+	if len(problems) == 0 {
+		t.Fatal("expected problems")
+	}
+	if pos := problems[0].Position.String(); pos != "sloppy.proto:6:1" {
+		t.Errorf("expected position sloppy.proto:6:1, got %s", pos)
+	}
+}
@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/kyleconroy/pb/ast"
+	"github.com/kyleconroy/pb/token"
+)
+
+// commentMap records the comment groups found between tokens, keyed by the
+// position of the token they belong to.
+type commentMap struct {
+	lead     map[token.Pos]*ast.CommentGroup   // group directly above a token
+	line     map[token.Pos]*ast.CommentGroup   // group on the same line after a token
+	detached map[token.Pos][]*ast.CommentGroup // groups above a token, separated by a blank line
+}
+
+func newCommentMap() *commentMap {
+	return &commentMap{
+		lead:     map[token.Pos]*ast.CommentGroup{},
+		line:     map[token.Pos]*ast.CommentGroup{},
+		detached: map[token.Pos][]*ast.CommentGroup{},
+	}
+}
+
+// groupComments sorts the comments found between the previously returned
+// token and next into groups. Comments on the same line as the previous
+// token trail it; the last group directly above next leads it and any
+// other groups are detached.
+func (t *tree) groupComments(comments []item, next item) {
+	prevLine := 0
+	if t.token[0].typ != token.ILLEGAL {
+		// A previous token has been returned
+		prevLine = t.l.file.Line(t.pos(t.token[0]))
+	}
+
+	var line *ast.CommentGroup
+	var groups []*ast.CommentGroup
+	var group *ast.CommentGroup
+	endLine := 0
+	for _, c := range comments {
+		comment := &ast.Comment{Slash: t.pos(c), Text: strings.TrimRight(c.val, "\r\n")}
+		start := t.l.file.Line(comment.Pos())
+		switch {
+		case start == prevLine:
+			if line == nil {
+				line = &ast.CommentGroup{}
+				t.f.Comments = append(t.f.Comments, line)
+			}
+			line.List = append(line.List, comment)
+		case group == nil || start > endLine+1:
+			group = &ast.CommentGroup{List: []*ast.Comment{comment}}
+			groups = append(groups, group)
+			t.f.Comments = append(t.f.Comments, group)
+		default:
+			group.List = append(group.List, comment)
+		}
+		endLine = t.l.file.Line(comment.End() - 1)
+	}
+
+	if line != nil {
+		t.comments.line[t.pos(t.token[0])] = line
+	}
+	if len(groups) == 0 {
+		return
+	}
+	pos := t.pos(next)
+	last := groups[len(groups)-1]
+	if t.l.file.Line(last.End()-1) >= t.l.file.Line(pos)-1 {
+		t.comments.lead[pos] = last
+		groups = groups[:len(groups)-1]
+	}
+	if len(groups) > 0 {
+		t.comments.detached[pos] = groups
+	}
+}
+
+// Visit attaches the recorded comment groups to the nodes that carry
+// documentation. Trailing comments of blocks follow the opening brace.
+func (m *commentMap) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.Enum:
+		n.Detached, n.Doc, n.Comment = m.detached[n.Pos()], m.lead[n.Pos()], m.line[n.Opening]
+	case *ast.EnumField:
+		n.Detached, n.Doc, n.Comment = m.detached[n.Pos()], m.lead[n.Pos()], m.line[n.Semicolon]
+	case *ast.Group:
+		n.Detached, n.Doc, n.Comment = m.detached[n.Pos()], m.lead[n.Pos()], m.line[n.Opening]
+	case *ast.Message:
+		n.Detached, n.Doc, n.Comment = m.detached[n.Pos()], m.lead[n.Pos()], m.line[n.Opening]
+	case *ast.MessageField:
+		n.Detached, n.Doc, n.Comment = m.detached[n.Pos()], m.lead[n.Pos()], m.line[n.Semicolon]
+	case *ast.OneOf:
+		n.Detached, n.Doc, n.Comment = m.detached[n.Pos()], m.lead[n.Pos()], m.line[n.Opening]
+	case *ast.RPC:
+		n.Detached, n.Doc, n.Comment = m.detached[n.Pos()], m.lead[n.Pos()], m.line[n.Closing]
+	case *ast.Service:
+		n.Detached, n.Doc = m.detached[n.Pos()], m.lead[n.Pos()]
+		if n.Body != nil {
+			n.Comment = m.line[n.Body.Opening]
+		}
+	}
+	return m
+}
@@ -2,10 +2,10 @@ package parser
 
 import (
 	"fmt"
-	"strconv"
-	"unicode"
+	"strings"
 	"unicode/utf8"
 
+	"github.com/kyleconroy/pb/scanner"
 	"github.com/kyleconroy/pb/token"
 )
 
@@ -20,356 +20,145 @@ func (p Pos) Position() Pos {
 // Inspired by https://github.com/golang/go/blob/master/src/text/template/parse/lex.go
 // item represents a token or text string returned from the scanner.
 type item struct {
-	typ itemType // The type of this item.
-	pos Pos      // The starting position, in bytes, of this item in the input string.
-	val string   // The value of this item.
+	typ token.Token // The type of this item.
+	pos Pos         // The starting position, in bytes, of this item in the input string.
+	val string      // The value of this item.
 }
 
 func (i item) String() string {
 	switch {
-	case i.typ == itemEOF:
+	case i.typ == token.EOF:
 		return "EOF"
-	case i.typ == itemError:
+	case i.typ == token.ILLEGAL:
 		return i.val
-	case i.typ > itemKeyword:
-		return fmt.Sprintf("<%s>", i.val)
 	case len(i.val) > 10:
 		return fmt.Sprintf("%.10q...", i.val)
 	}
 	return fmt.Sprintf("%q", i.val)
 }
 
-// https://developers.google.com/protocol-buffers/docs/reference/proto3-spec#string_literals
-// itemType identifies the type of lex items.
-type itemType int
-
-const (
-	itemError itemType = iota // error occurred; value is text of error
-	itemEOF                   // end
-
-	itemDot          // .
-	itemComma        // ,
-	itemEq           // =
-	itemSemiColon    // ;
-	itemLeftBrace    // {
-	itemRightBrace   // }
-	itemLeftParen    // (
-	itemRightParen   // )
-	itemLeftBracket  // [
-	itemRightBracket // ]
-	itemLeftMap      // <
-	itemRightMap     // >
-	itemIdent        // letter { letter | unicodeDigit | "_" }
-	itemFullIdent    // ident { "." ident }
-	itemStrLit       // ( "'" { charValue } "'" ) |  ( '"' { charValue } '"' )
-	itemIntLit       // 0 ... 9
-	itemBoolLit      // true | false
-	itemComment      // comment
-
-	// keywords
-	itemKeyword
-	itemSyntax       // syntax
-	itemMessage      // message
-	itemOneOf        // oneof
-	itemEnum         // enum
-	itemImport       // import
-	itemImportWeak   // weak
-	itemImportPublic // public
-	itemPackage      // package
-	itemOption       // option
-	itemMap          // map
-	itemRepeated     // repreated
-	itemReturns      // returns
-	itemRPC          // rpc
-	itemService      // service
-)
-
-// stateFn represents the state of the scanner as a function that returns the next state.
-type stateFn func(*lexer) stateFn
-
-const eof = -1
-
-const (
-	tokSyntax = "syntax"
-)
+// is reports whether the item is a token of type typ. Keywords are scanned
+// as identifiers, so an identifier is also of the keyword type it spells;
+// the parser decides from context whether it acts as a keyword.
+func (i item) is(typ token.Token) bool {
+	if typ.IsKeyword() {
+		return i.typ == token.IDENT && i.val == typ.String()
+	}
+	return i.typ == typ
+}
 
-// lexer holds the state of the scanner.
+// lexer turns the tokens of a scanner.Scanner into items for the parser.
 type lexer struct {
-	file         *token.File
-	name         string    // the name of the input; used only for error reports
-	input        string    // the string being scanned
-	leftDelim    string    // start of action
-	rightDelim   string    // end of action
-	state        stateFn   // the next lexing function to enter
-	pos          Pos       // current position in the input
-	start        Pos       // start position of this item
-	width        Pos       // width of last rune read from input
-	lastPos      Pos       // position of most recent item returned by nextItem
-	items        chan item // channel of scanned items
-	braceDepth   int       // nesting depth of { }
-	bracketDepth int       // nesting depth of [ ]
-	parenDepth   int       // nesting depth of ( )
-	mapDepth     int       // nesting depth of < >
+	file    *token.File
+	input   string          // the string being scanned
+	scanner scanner.Scanner // underlying scanner
 }
 
-func lex(f *token.File, name, input string) *lexer {
+func lex(f *token.File, src []byte, err scanner.ErrorHandler) *lexer {
 	l := &lexer{
-		name:  name,
-		input: input,
-		items: make(chan item),
 		file:  f,
+		input: string(src),
 	}
-	go l.run() // Concurrently run state machine.
+	l.scanner.Init(f, src, err, scanner.ScanComments)
 	return l
 }
 
-// run lexes the input by executing state functions until
-// the state is nil.
-func (l *lexer) run() {
-	for state := lexSchema; state != nil; {
-		state = state(l)
-	}
-	close(l.items) // No more tokens will be delivered.
-}
-
 // nextItem returns the next item from the input.
-// Called by the parser, not in the lexing goroutine.
 func (l *lexer) nextItem() item {
-	item := <-l.items
-	l.lastPos = item.pos
-	return item
-}
-
-// drain drains the output so the lexing goroutine will exit.
-// Called by the parser, not in the lexing goroutine.
-func (l *lexer) drain() {
-	for _ = range l.items {
+	pos, tok, lit := l.scanner.Scan()
+	if tok.IsOperator() {
+		lit = tok.String()
 	}
+	return item{typ: tok, pos: Pos(l.file.Offset(pos)), val: lit}
 }
 
-// emit passes an item back to the client.
-func (l *lexer) emit(t itemType) {
-	l.items <- item{t, l.pos, l.input[l.start:l.pos]}
-	l.start = l.pos
-}
-
-// errorf returns an error token and terminates the scan by passing
-// back a nil pointer that will be the next state, terminating l.nextItem.
-func (l *lexer) errorf(format string, args ...interface{}) stateFn {
-	l.items <- item{itemError, l.start, fmt.Sprintf(format, args...)}
-	return nil
-}
-
-// next returns the next rune in the input.
-func (l *lexer) next() rune {
-	if int(l.pos) >= len(l.input) {
-		l.width = 0
-		return eof
-	}
-	r, w := utf8.DecodeRuneInString(l.input[l.pos:])
-	l.width = Pos(w)
-	l.pos += l.width
-	if r == '\n' {
-		l.file.AddLine(int(l.pos))
+// unquote decodes the value of a single or double quoted string literal,
+// including simple, hex, octal and unicode escape sequences.
+func unquote(lit string) (string, error) {
+	n := len(lit)
+	if n < 2 || lit[0] != lit[n-1] || (lit[0] != '"' && lit[0] != '\'') {
+		return "", fmt.Errorf("invalid string literal: %s", lit)
 	}
-	return r
-}
-
-// peek returns but does not consume the next rune in the input.
-func (l *lexer) peek() rune {
-	r := l.next()
-	l.backup()
-	return r
-}
-
-// backup steps back one rune. Can only be called once per call of next.
-func (l *lexer) backup() {
-	l.pos -= l.width
-}
-
-// isSpace reports whether r is a space character.
-func isSpace(r rune) bool {
-	return r == ' ' || r == '\t' || r == '\n'
-}
-
-// Consume spaces
-func (l *lexer) trim() {
-	for isSpace(l.peek()) {
-		l.next()
-	}
-	l.start = l.pos
-}
-
-func lexSchema(l *lexer) stateFn {
-	// Ignore whitespace, it doesn't matter
-	l.trim()
-	switch r := l.next(); {
-	case r == '.':
-		l.emit(itemDot)
-	case r == '<':
-		l.emit(itemLeftMap)
-		l.mapDepth++
-	case r == '>':
-		l.emit(itemRightMap)
-		l.mapDepth--
-	case r == '[':
-		l.emit(itemLeftBracket)
-		l.bracketDepth++
-	case r == ']':
-		l.emit(itemRightBracket)
-		l.bracketDepth--
-	case r == '(':
-		l.emit(itemLeftParen)
-		l.parenDepth++
-	case r == ')':
-		l.emit(itemRightParen)
-		l.parenDepth--
-	case r == '{':
-		l.emit(itemLeftBrace)
-		l.braceDepth++
-	case r == '}':
-		l.emit(itemRightBrace)
-		l.braceDepth--
-		if l.braceDepth < 0 {
-			return l.errorf("unexpected right brace %#U", r)
+	s := lit[1 : n-1]
+
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); {
+		if s[i] != '\\' {
+			buf = append(buf, s[i])
+			i++
+			continue
 		}
-	case r == ',':
-		if l.mapDepth <= 0 {
-			return l.errorf("unexpected comman outside of map definition %#U", r)
+		if i+1 >= len(s) {
+			return "", fmt.Errorf("invalid escape sequence in %s", lit)
 		}
-		l.emit(itemComma)
-	case r == '=':
-		l.emit(itemEq)
-	case r == '"':
-		return lexQuote
-	case r == ';':
-		l.emit(itemSemiColon)
-	case r == '/':
-		return lexComment
-	case isAlphaNumeric(r):
-		l.backup()
-		return lexIdentOrKeyword
-	case r == eof:
-		return lexEnd
-	default:
-		return l.errorf("unrecognized character in action: %#U", r)
-	}
-	return lexSchema
-}
-
-var key = map[string]itemType{
-	"syntax":   itemSyntax,
-	"import":   itemImport,
-	"weak":     itemImportWeak,
-	"public":   itemImportPublic,
-	"message":  itemMessage,
-	"enum":     itemEnum,
-	"option":   itemOption,
-	"map":      itemMap,
-	"rpc":      itemRPC,
-	"returns":  itemReturns,
-	"service":  itemService,
-	"repeated": itemRepeated,
-	"package":  itemPackage,
-	"oneof":    itemOneOf,
-}
-
-func lexComment(l *lexer) stateFn {
-	if l.next() != '/' {
-		return l.errorf("comments must start with two backslashes")
-	}
-	for {
-		r := l.next()
-		if r == '\n' || r == '\r' || r == eof {
-			l.emit(itemComment)
-			return lexSchema
-		}
-	}
-}
-
-// lexIdentifier scans an alphanumeric.
-func lexIdentOrKeyword(l *lexer) stateFn {
-	l.trim()
-	for {
-		switch r := l.next(); {
-		case isAlphaNumeric(r):
-			// absorb.
-		default:
-			l.backup()
-			word := l.input[l.start:l.pos]
-			switch i := key[word]; {
-			case i == itemImport || i == itemSyntax || i == itemPackage:
-				// When we're inside {} brackets, syntax import and package aren't keywords
-				if l.braceDepth > 0 {
-					l.emit(itemIdent)
-				} else {
-					l.emit(i)
-				}
-				return lexSchema
-			case i == itemEnum || i == itemMessage || i == itemService || i == itemRPC:
-				l.emit(i)
-				return lexIdent
-			case i == itemReturns || i == itemOption || i == itemRepeated || i == itemOneOf:
-				l.emit(i)
-				return lexSchema
-			case i == itemMap || i == itemImportPublic || i == itemImportWeak:
-				l.emit(i)
-				return lexSchema
-			case word == "true" || word == "false":
-				l.emit(itemBoolLit)
-				return lexSchema
-			default:
-				// TODO: This is pretty crappy
-				if _, err := strconv.Atoi(word); err == nil {
-					l.emit(itemIntLit)
-				} else {
-					l.emit(itemIdent)
-				}
-				return lexSchema
+		c := s[i+1]
+		i += 2
+		switch c {
+		case 'a':
+			buf = append(buf, '\a')
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'v':
+			buf = append(buf, '\v')
+		case '\\', '\'', '"', '?':
+			buf = append(buf, c)
+		case 'x', 'X':
+			v, w := digitVal(s[i:], 16, 2)
+			if w == 0 {
+				return "", fmt.Errorf("invalid hex escape in %s", lit)
 			}
-		}
-	}
-}
-
-// lexIdentifier scans an alphanumeric.
-func lexIdent(l *lexer) stateFn {
-	l.trim()
-	for {
-		switch r := l.next(); {
-		case isAlphaNumeric(r):
-			// absorb.
+			buf = append(buf, byte(v))
+			i += w
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			v, w := digitVal(s[i-1:], 8, 3)
+			if v > 255 {
+				return "", fmt.Errorf("octal escape out of range in %s", lit)
+			}
+			buf = append(buf, byte(v))
+			i += w - 1
+		case 'u', 'U':
+			size := 4
+			if c == 'U' {
+				size = 8
+			}
+			v, w := digitVal(s[i:], 16, size)
+			if w != size || !utf8.ValidRune(rune(v)) {
+				return "", fmt.Errorf("invalid unicode escape in %s", lit)
+			}
+			var enc [utf8.UTFMax]byte
+			buf = append(buf, enc[:utf8.EncodeRune(enc[:], rune(v))]...)
+			i += w
 		default:
-			l.backup()
-			l.emit(itemIdent)
-			return lexSchema
+			return "", fmt.Errorf("invalid escape sequence \\%c in %s", c, lit)
 		}
 	}
+	return string(buf), nil
 }
 
-// lexQuote scans a quoted string.
-func lexQuote(l *lexer) stateFn {
-	for {
-		switch l.next() {
-		//case '\\':
-		//	if r := l.next(); r != eof && r != '\n' {
-		//		break
-		//	}
-		//	fallthrough
-		case eof, '\n':
-			return l.errorf("unterminated quoted string")
-		case '"':
-			l.emit(itemStrLit)
-			return lexSchema
+// digitVal parses up to max leading digits of s in the given base,
+// returning the value and the number of digits consumed.
+func digitVal(s string, base, max int) (int, int) {
+	v, w := 0, 0
+	for w < max && w < len(s) {
+		d := strings.IndexByte("0123456789abcdef", lower(s[w]))
+		if d < 0 || d >= base {
+			break
 		}
+		v = v*base + d
+		w++
 	}
+	return v, w
 }
 
-func lexEnd(l *lexer) stateFn {
-	l.emit(itemEOF)
-	return nil
-}
-
-// isAlphaNumeric reports whether r is an alphabetic, digit, or underscore.
-func isAlphaNumeric(r rune) bool {
-	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+// lower returns the lowercase version of an ASCII letter.
+func lower(c byte) byte {
+	return c | ('x' - 'X')
 }
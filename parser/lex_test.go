@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -11,31 +12,63 @@ import (
 	"github.com/kyleconroy/pb/token"
 )
 
+// wellKnownDir holds the well-known types, which are parsed alongside the
+// files in _protos.
+var wellKnownDir = filepath.Join("..", "wellknown", "google", "protobuf")
+
+// protoFiles returns the names of the test protos.
+func protoFiles() []string {
+	files, _ := filepath.Glob(filepath.Join("_protos", "*.proto"))
+	wellKnown, _ := filepath.Glob(filepath.Join(wellKnownDir, "*.proto"))
+	return append(files, wellKnown...)
+}
+
 func TestProtos(t *testing.T) {
 
-	files, _ := ioutil.ReadDir("./_protos")
-	for _, f := range files {
-		if strings.HasPrefix(f.Name(), ".") {
-			continue
-		}
-		t.Run(f.Name(), func(t *testing.T) {
+	for _, name := range protoFiles() {
+		t.Run(filepath.Base(name), func(t *testing.T) {
 			fset := token.NewFileSet()
-			handle, err := os.Open(filepath.Join(".", "_protos", f.Name()))
+			handle, err := os.Open(name)
 			if err != nil {
 				t.Error(err)
 				return
 			}
-			f, err := ParseFile(fset, f.Name(), handle, 0)
+			f, err := ParseFile(fset, filepath.Base(name), handle, 0)
 			if err != nil {
 				t.Error(err)
 			}
-			if f.Syntax != ast.Proto3 {
-				t.Error("The syntax should be proto3")
+			// The descriptor types are the only proto2 files
+			if proto2 := filepath.Base(name) == "descriptor.proto"; proto2 != (f.Syntax == ast.Proto2) {
+				t.Errorf("unexpected syntax %v", f.Syntax)
 			}
 		})
 	}
 }
 
+func BenchmarkParseFile(b *testing.B) {
+	files := protoFiles()
+	srcs := make([]string, len(files))
+	size := 0
+	for i, name := range files {
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		srcs[i] = string(src)
+		size += len(src)
+	}
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, src := range srcs {
+			fset := token.NewFileSet()
+			if _, err := ParseFile(fset, files[j], strings.NewReader(src), 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
 func TestError(t *testing.T) {
 	fset := token.NewFileSet()
 	_, err := ParseFile(fset, "", strings.NewReader("foo"), 0)
@@ -43,3 +76,1128 @@ func TestError(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestErrorMessages(t *testing.T) {
+	for src, expected := range map[string]string{
+		`message M { int32 a =`:  "1:22: unexpected token: EOF",
+		`message M { int32 a; }`: `1:20: unexpected token: ";"`,
+		`message M { = }`:        `1:13: unexpected token in message: "="`,
+		`message M {`:            "1:12: expected }, found EOF",
+	} {
+		fset := token.NewFileSet()
+		_, err := ParseFile(fset, "", strings.NewReader(src), 0)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected %s, got %v", src, expected, err)
+		}
+	}
+}
+
+const positions = `syntax = "proto3";
+
+package foo;
+
+message Foo {
+  repeated int64 bar = 1;
+  map<int32, string> baz = 2;
+}
+
+service Bar {
+  rpc Get(Foo) returns (Foo) {}
+}
+`
+
+type positionChecker struct {
+	t *testing.T
+}
+
+func (c positionChecker) Visit(n ast.Node) ast.Visitor {
+	if n == nil {
+		return nil
+	}
+	if !n.Pos().IsValid() {
+		c.t.Errorf("%T has an invalid position", n)
+	}
+	if n.End() <= n.Pos() {
+		c.t.Errorf("%T ends (%d) before it starts (%d)", n, n.End(), n.Pos())
+	}
+	return c
+}
+
+func TestPositions(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "positions.proto", strings.NewReader(positions), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast.Walk(positionChecker{t}, f)
+
+	for _, tc := range []struct {
+		node ast.Node
+		pos  string
+		end  string
+	}{
+		{f, "positions.proto:1:1", "positions.proto:12:3"},
+		{f.Nodes[0], "positions.proto:3:1", "positions.proto:3:13"},
+		{f.Nodes[1], "positions.proto:5:1", "positions.proto:8:2"},
+		{f.Nodes[1].(*ast.Message).Body[0], "positions.proto:6:3", "positions.proto:6:26"},
+		{f.Nodes[1].(*ast.Message).Body[1].(*ast.MessageField).Type, "positions.proto:7:3", "positions.proto:7:21"},
+		{f.Nodes[2].(*ast.Service).Body.List[0], "positions.proto:11:3", "positions.proto:11:32"},
+	} {
+		if pos := fset.Position(tc.node.Pos()).String(); pos != tc.pos {
+			t.Errorf("%T: expected position %s, got %s", tc.node, tc.pos, pos)
+		}
+		if end := fset.Position(tc.node.End()).String(); end != tc.end {
+			t.Errorf("%T: expected end %s, got %s", tc.node, tc.end, end)
+		}
+	}
+}
+
+const proto2 = `syntax = "proto2";
+
+message SearchResponse {
+  required string query = 1;
+  optional int32 page = 2 [default = 10];
+  optional Corpus corpus = 3 [default = UNIVERSAL];
+  repeated group Result = 4 {
+    required string url = 5;
+    optional string title = 6 [default = "untitled"];
+  }
+  extensions 100 to 199, 250, 1000 to max [verification = UNVERIFIED];
+}
+`
+
+func TestProto2(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "proto2.proto", strings.NewReader(proto2), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Syntax != ast.Proto2 {
+		t.Error("The syntax should be proto2")
+	}
+
+	body := f.Nodes[0].(*ast.Message).Body
+	if len(body) != 5 {
+		t.Fatalf("expected 5 message statements, got %d", len(body))
+	}
+	if label := body[0].(*ast.MessageField).Label.Name; label != "required" {
+		t.Errorf("expected required label, got %s", label)
+	}
+	if def := body[1].(*ast.MessageField).Default.(*ast.BasicLit); def.Value != "10" {
+		t.Errorf("expected default of 10, got %s", def.Value)
+	}
+	if def := body[2].(*ast.MessageField).Default.(*ast.Ident); def.Name != "UNIVERSAL" {
+		t.Errorf("expected default of UNIVERSAL, got %s", def.Name)
+	}
+
+	group := body[3].(*ast.Group)
+	if group.Name.Name != "Result" || group.Label.Name != "repeated" || len(group.Body) != 2 {
+		t.Errorf("unexpected group: %#v", group)
+	}
+
+	ext := body[4].(*ast.Extensions)
+	if len(ext.Ranges) != 3 {
+		t.Fatalf("expected 3 extension ranges, got %d", len(ext.Ranges))
+	}
+	if ext.Ranges[1].High != nil {
+		t.Errorf("expected a single number range, got %#v", ext.Ranges[1].High)
+	}
+	if max := ext.Ranges[2].High.(*ast.Ident); max.Name != "max" {
+		t.Errorf("expected range to end at max, got %s", max.Name)
+	}
+	if len(ext.Options) != 1 || ext.Options[0].Constant.(*ast.Ident).Name != "UNVERIFIED" {
+		t.Errorf("expected the verification option, got %#v", ext.Options)
+	}
+}
+
+func TestMissingSyntax(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "", strings.NewReader("message Foo { optional int32 bar = 1; }"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Syntax != ast.Proto2 {
+		t.Error("The syntax should default to proto2")
+	}
+}
+
+func TestProto3Required(t *testing.T) {
+	fset := token.NewFileSet()
+	src := `syntax = "proto3"; message Foo { required int32 bar = 1; }`
+	if _, err := ParseFile(fset, "", strings.NewReader(src), 0); err == nil {
+		t.Error("expected an error for a required field in proto3")
+	}
+}
+
+func TestProto3Proto2Only(t *testing.T) {
+	for src, expected := range map[string]string{
+		`syntax = "proto3"; message Foo { int32 a = 1 [default = 2]; int32 b = 2; }`: "1:47: default values are not allowed in proto3",
+		`syntax = "proto3"; message Foo { extensions 100 to max; int32 b = 2; }`:     "1:34: extension ranges are not allowed in proto3",
+		`syntax = "proto3"; message Foo { group A = 1 {} int32 b = 2; }`:             "1:46: groups are only allowed in proto2",
+	} {
+		fset := token.NewFileSet()
+		f, err := ParseFile(fset, "", strings.NewReader(src), 0)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected %s, got %v", src, expected, err)
+		}
+		// The rest of the message is still parsed
+		body := f.Nodes[0].(*ast.Message).Body
+		if field, ok := body[len(body)-1].(*ast.MessageField); !ok || field.Name.Name != "b" {
+			t.Errorf("%s: expected field b to be parsed", src)
+		}
+	}
+}
+
+const editions = `edition = "2023";
+
+option features.field_presence = IMPLICIT;
+
+message Foo {
+  option features.message_encoding = DELIMITED;
+  int32 bar = 1 [features.field_presence = EXPLICIT];
+}
+
+enum Bar {
+  option features.enum_type = CLOSED;
+  BAR_UNKNOWN = 0;
+}
+`
+
+func TestEditions(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "editions.proto", strings.NewReader(editions), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Syntax != ast.Editions || f.Edition != "2023" {
+		t.Errorf("expected edition 2023, got %v %q", f.Syntax, f.Edition)
+	}
+
+	msg := f.Nodes[1].(*ast.Message)
+	for _, tc := range []struct {
+		opt   *ast.Option
+		name  string
+		value string
+	}{
+		{f.Nodes[0].(*ast.Option), "field_presence", "IMPLICIT"},
+		{msg.Body[0].(*ast.Option), "message_encoding", "DELIMITED"},
+		{msg.Body[1].(*ast.MessageField).Options[0], "field_presence", "EXPLICIT"},
+		{f.Nodes[2].(*ast.Enum).Body[0].(*ast.Option), "enum_type", "CLOSED"},
+	} {
+		if len(tc.opt.Names) != 2 || fmt.Sprint(tc.opt.Names[0].Name) != "features" || fmt.Sprint(tc.opt.Names[1].Name) != tc.name {
+			t.Errorf("expected features.%s, got %#v", tc.name, tc.opt.Names)
+		}
+		if value := tc.opt.Constant.(*ast.Ident).Name; value != tc.value {
+			t.Errorf("expected %s, got %s", tc.value, value)
+		}
+	}
+}
+
+func TestEditionsLabels(t *testing.T) {
+	fset := token.NewFileSet()
+	src := `edition = "2023"; message Foo { optional int32 bar = 1; }`
+	if _, err := ParseFile(fset, "", strings.NewReader(src), 0); err == nil {
+		t.Error("expected an error for an optional field in editions")
+	}
+}
+
+func TestEditionsReserved(t *testing.T) {
+	fset := token.NewFileSet()
+	src := `edition = "2023"; message Foo { reserved foo, bar; reserved 3; } enum Baz { reserved QUX; BAZ_UNKNOWN = 0; }`
+	f, err := ParseFile(fset, "", strings.NewReader(src), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := f.Nodes[0].(*ast.Message).Body[0].(*ast.Reserved).Names
+	if len(names) != 2 || names[0].(*ast.Ident).Name != "foo" || names[1].(*ast.Ident).Name != "bar" {
+		t.Errorf("expected reserved foo and bar, got %#v", names)
+	}
+	if name := f.Nodes[1].(*ast.Enum).Body[0].(*ast.Reserved).Names[0].(*ast.Ident); name.Name != "QUX" {
+		t.Errorf("expected reserved QUX, got %s", name.Name)
+	}
+
+	for _, src := range []string{
+		`edition = "2023"; message Foo { reserved "foo"; }`,
+		`edition = "2023"; message Foo { reserved foo, "bar"; }`,
+		`syntax = "proto3"; message Foo { reserved foo; }`,
+	} {
+		fset := token.NewFileSet()
+		if _, err := ParseFile(fset, "", strings.NewReader(src), 0); err == nil {
+			t.Errorf("expected an error for %s", src)
+		}
+	}
+}
+
+const reserved = `syntax = "proto3";
+
+message Foo {
+  reserved 2, 15, 9 to 11, 40 to max;
+  reserved "foo", "bar";
+}
+
+enum Bar {
+  reserved 1, 5 to 7;
+  reserved "BAZ";
+  BAR_UNKNOWN = 0;
+}
+`
+
+func TestReserved(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "reserved.proto", strings.NewReader(reserved), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := f.Nodes[0].(*ast.Message)
+	nums := msg.Body[0].(*ast.Reserved)
+	if len(nums.Ranges) != 4 || len(nums.Names) != 0 {
+		t.Fatalf("expected 4 reserved ranges, got %#v", nums)
+	}
+	if high := nums.Ranges[2].High.(*ast.BasicLit); high.Value != "11" {
+		t.Errorf("expected range to end at 11, got %s", high.Value)
+	}
+	if max := nums.Ranges[3].High.(*ast.Ident); max.Name != "max" {
+		t.Errorf("expected range to end at max, got %s", max.Name)
+	}
+	names := msg.Body[1].(*ast.Reserved)
+	if len(names.Names) != 2 || names.Names[1].(*ast.BasicLit).Value != `"bar"` {
+		t.Errorf("expected reserved names foo and bar, got %#v", names.Names)
+	}
+
+	enum := f.Nodes[1].(*ast.Enum)
+	if r := enum.Body[0].(*ast.Reserved); len(r.Ranges) != 2 {
+		t.Errorf("expected 2 reserved ranges, got %d", len(r.Ranges))
+	}
+	if r := enum.Body[1].(*ast.Reserved); len(r.Names) != 1 {
+		t.Errorf("expected 1 reserved name, got %d", len(r.Names))
+	}
+}
+
+const fieldOptions = `syntax = "proto3";
+
+message Foo {
+  repeated int32 samples = 4 [packed=true];
+  string id = 1 [json_name="ID", deprecated=true];
+  int32 old = 2 [(my.ext).sub = 5];
+  oneof bar {
+    string baz = 3 [deprecated=true];
+  }
+}
+
+enum Bar {
+  BAR_UNKNOWN = 0 [(custom_option) = "hello world"];
+}
+`
+
+func TestFieldOptions(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "options.proto", strings.NewReader(fieldOptions), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := f.Nodes[0].(*ast.Message)
+	if opts := msg.Body[0].(*ast.MessageField).Options; len(opts) != 1 || fmt.Sprint(opts[0].Names[0].Name) != "packed" {
+		t.Errorf("expected packed option, got %#v", opts)
+	}
+	if opts := msg.Body[1].(*ast.MessageField).Options; len(opts) != 2 || fmt.Sprint(opts[1].Names[0].Name) != "deprecated" {
+		t.Errorf("expected json_name and deprecated options, got %#v", opts)
+	}
+
+	custom := msg.Body[2].(*ast.MessageField).Options[0]
+	if len(custom.Names) != 2 {
+		t.Fatalf("expected 2 option name parts, got %d", len(custom.Names))
+	}
+	if ext := custom.Names[0]; !ext.Extension || fmt.Sprint(ext.Name) != "my.ext" {
+		t.Errorf("expected (my.ext) extension, got %#v", ext)
+	}
+	if sub := custom.Names[1]; sub.Extension || fmt.Sprint(sub.Name) != "sub" {
+		t.Errorf("expected sub name, got %#v", sub)
+	}
+
+	oneof := msg.Body[3].(*ast.OneOf)
+	if opts := oneof.Body[0].(*ast.MessageField).Options; len(opts) != 1 {
+		t.Errorf("expected 1 option, got %d", len(opts))
+	}
+
+	value := f.Nodes[1].(*ast.Enum).Body[0].(*ast.EnumField)
+	if len(value.Options) != 1 || !value.Options[0].Names[0].Extension {
+		t.Errorf("expected (custom_option) option, got %#v", value.Options)
+	}
+}
+
+const options = `syntax = "proto3";
+
+option optimize_for = SPEED;
+option (my_option).a = true;
+option (int_opt) = -42;
+option (float_opt) = 1.5e10;
+option (neg_float_opt) = -0.25;
+
+service Foo {
+  option (http) = {
+    get: "/v1/x"
+    body: "*"
+    additional_bindings { post: "/v1/y" }
+    [my.ext]: [1, 2, 3];
+    [type.googleapis.com/pkg.Msg] { id: 1 }
+    additional_bindings [{ post: "/v1/z" }, < get: "/v1/z" >]
+  };
+}
+
+enum Bar {
+  option (enum_opt) = 3;
+  BAR_UNKNOWN = 0;
+  BAR_NEGATIVE = -1;
+}
+`
+
+func TestOptions(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "options.proto", strings.NewReader(options), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tc := range []struct {
+		kind  token.Token
+		value string
+	}{
+		{token.ILLEGAL, "SPEED"},
+		{token.BOOL, "true"},
+		{token.INT, "-42"},
+		{token.FLOAT, "1.5e10"},
+		{token.FLOAT, "-0.25"},
+	} {
+		switch con := f.Nodes[i].(*ast.Option).Constant.(type) {
+		case *ast.Ident:
+			if tc.kind != token.ILLEGAL || con.Name != tc.value {
+				t.Errorf("option %d: expected %s, got identifier %s", i, tc.value, con.Name)
+			}
+		case *ast.BasicLit:
+			if con.Kind != tc.kind || con.Value != tc.value {
+				t.Errorf("option %d: expected %s, got %s", i, tc.value, con.Value)
+			}
+		default:
+			t.Errorf("option %d: unexpected constant %#v", i, con)
+		}
+	}
+
+	names := f.Nodes[1].(*ast.Option).Names
+	if len(names) != 2 || !names[0].Extension || fmt.Sprint(names[0].Name) != "my_option" || names[1].Extension {
+		t.Errorf("expected (my_option).a, got %#v", names)
+	}
+
+	srv := f.Nodes[5].(*ast.Service)
+	http := srv.Body.List[0].(*ast.Option).Constant.(*ast.MessageLit)
+	if len(http.Fields) != 6 {
+		t.Fatalf("expected 6 fields, got %d", len(http.Fields))
+	}
+	if get := http.Fields[0].Value.(*ast.BasicLit); get.Value != `"/v1/x"` {
+		t.Errorf(`expected "/v1/x", got %s`, get.Value)
+	}
+	if nested := http.Fields[2].Value.(*ast.MessageLit); len(nested.Fields) != 1 {
+		t.Errorf("expected 1 nested field, got %d", len(nested.Fields))
+	}
+	if ext := http.Fields[3]; !ext.Extension || fmt.Sprint(ext.Name) != "my.ext" || len(ext.Value.(*ast.ListLit).Values) != 3 {
+		t.Errorf("expected [my.ext] list, got %#v", ext)
+	}
+	if any := http.Fields[4]; any.Prefix != "type.googleapis.com" || fmt.Sprint(any.Name) != "pkg.Msg" {
+		t.Errorf("expected [type.googleapis.com/pkg.Msg], got %#v", any)
+	}
+	if list := http.Fields[5]; list.Colon.IsValid() || len(list.Value.(*ast.ListLit).Values) != 2 {
+		t.Errorf("expected a list of 2 messages without colon, got %#v", list)
+	}
+
+	enum := f.Nodes[6].(*ast.Enum)
+	if v := enum.Body[2].(*ast.EnumField).Value; v != "-1" {
+		t.Errorf("expected -1, got %s", v)
+	}
+}
+
+const streaming = `syntax = "proto3";
+
+service Watcher {
+  rpc Watch(stream Req) returns (stream Resp);
+  rpc Upload(stream Chunk) returns (Summary) {}
+  rpc Get(GetReq) returns (GetResp) {
+    option (google.api.http) = { get: "/v1/things" };
+    option deprecated = true;
+  }
+  rpc Stream(stream) returns (stream);
+}
+`
+
+func TestRPC(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "streaming.proto", strings.NewReader(streaming), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rpcs := f.Nodes[0].(*ast.Service).Body.List
+	for i, tc := range []struct {
+		in, out        string
+		client, server bool
+		options        int
+	}{
+		{"Req", "Resp", true, true, 0},
+		{"Chunk", "Summary", true, false, 0},
+		{"GetReq", "GetResp", false, false, 2},
+		{"stream", "stream", false, false, 0},
+	} {
+		rpc := rpcs[i].(*ast.RPC)
+		if fmt.Sprint(rpc.InType) != tc.in || fmt.Sprint(rpc.OutType) != tc.out {
+			t.Errorf("rpc %d: expected (%s) returns (%s), got (%s) returns (%s)", i, tc.in, tc.out, rpc.InType, rpc.OutType)
+		}
+		if rpc.ClientStreaming != tc.client || rpc.ServerStreaming != tc.server {
+			t.Errorf("rpc %d: expected streaming %v/%v, got %v/%v", i, tc.client, tc.server, rpc.ClientStreaming, rpc.ServerStreaming)
+		}
+		if len(rpc.Options) != tc.options {
+			t.Errorf("rpc %d: expected %d options, got %d", i, tc.options, len(rpc.Options))
+		}
+	}
+}
+
+const qualified = `syntax = "proto3";
+
+import "google/protobuf/timestamp.proto";
+
+message Foo {
+  google.protobuf.Timestamp created = 1;
+  .foo.bar.Baz baz = 2;
+  map<string, google.protobuf.Timestamp> times = 3;
+}
+
+service Bar {
+  rpc Get(.foo.GetReq) returns (stream foo.GetResp);
+}
+`
+
+func TestQualifiedNames(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "qualified.proto", strings.NewReader(qualified), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := f.Nodes[1].(*ast.Message)
+	created := msg.Body[0].(*ast.MessageField).Type.(*ast.FullIdent)
+	if created.Absolute || len(created.Parts) != 3 || created.String() != "google.protobuf.Timestamp" {
+		t.Errorf("expected google.protobuf.Timestamp, got %s", created)
+	}
+	baz := msg.Body[1].(*ast.MessageField).Type.(*ast.FullIdent)
+	if !baz.Absolute || baz.String() != ".foo.bar.Baz" {
+		t.Errorf("expected .foo.bar.Baz, got %s", baz)
+	}
+	if pos := fset.Position(baz.Pos()).String(); pos != "qualified.proto:7:3" {
+		t.Errorf("expected position qualified.proto:7:3, got %s", pos)
+	}
+	times := msg.Body[2].(*ast.MessageField).Type.(*ast.MapType)
+	if v := fmt.Sprint(times.Value); v != "google.protobuf.Timestamp" {
+		t.Errorf("expected google.protobuf.Timestamp, got %s", v)
+	}
+
+	rpc := f.Nodes[2].(*ast.Service).Body.List[0].(*ast.RPC)
+	if in := fmt.Sprint(rpc.InType); in != ".foo.GetReq" {
+		t.Errorf("expected .foo.GetReq, got %s", in)
+	}
+	if out := fmt.Sprint(rpc.OutType); out != "foo.GetResp" || !rpc.ServerStreaming {
+		t.Errorf("expected stream foo.GetResp, got %s", out)
+	}
+}
+
+func TestPackage(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		name string
+	}{
+		{`syntax = "proto3"; package foo;`, "foo"},
+		{`syntax = "proto3"; package foo.bar.baz;`, "foo.bar.baz"},
+		{`syntax = "proto3";`, ""},
+	} {
+		fset := token.NewFileSet()
+		f, err := ParseFile(fset, "package.proto", strings.NewReader(tc.src), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := f.PackageName(); name != tc.name {
+			t.Errorf("expected package %q, got %q", tc.name, name)
+		}
+		if pkg := f.Package(); tc.name != "" && fset.Position(pkg.Pos()).String() != "package.proto:1:20" {
+			t.Errorf("expected package at package.proto:1:20, got %s", fset.Position(pkg.Pos()))
+		}
+	}
+
+	for _, src := range []string{
+		`syntax = "proto3"; package .foo;`,
+		`syntax = "proto3"; package foo; package bar;`,
+	} {
+		fset := token.NewFileSet()
+		if _, err := ParseFile(fset, "", strings.NewReader(src), 0); err == nil {
+			t.Errorf("expected an error for %s", src)
+		}
+	}
+}
+
+const extend = `syntax = "proto2";
+
+import "google/protobuf/descriptor.proto";
+
+extend google.protobuf.FieldOptions {
+  optional string my_opt = 50000;
+}
+
+message Foo {
+  extensions 100 to 199;
+
+  extend Foo {
+    repeated int32 bar = 100;
+    optional group Baz = 101 {
+      optional int32 qux = 1;
+    }
+  }
+}
+`
+
+func TestExtend(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "extend.proto", strings.NewReader(extend), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := f.Nodes[1].(*ast.Extend)
+	if typ := fmt.Sprint(opts.Type); typ != "google.protobuf.FieldOptions" {
+		t.Errorf("expected google.protobuf.FieldOptions, got %s", typ)
+	}
+	if field := opts.Body[0].(*ast.MessageField); field.Name.Name != "my_opt" || field.Number.Value != "50000" {
+		t.Errorf("expected my_opt = 50000, got %s = %s", field.Name.Name, field.Number.Value)
+	}
+
+	nested := f.Nodes[2].(*ast.Message).Body[1].(*ast.Extend)
+	if typ := fmt.Sprint(nested.Type); typ != "Foo" {
+		t.Errorf("expected Foo, got %s", typ)
+	}
+	if len(nested.Body) != 2 {
+		t.Fatalf("expected 2 extension fields, got %d", len(nested.Body))
+	}
+	if _, ok := nested.Body[1].(*ast.Group); !ok {
+		t.Errorf("expected a group, got %T", nested.Body[1])
+	}
+}
+
+const literals = `/*
+ * Copyright 2016 The Authors. All rights reserved.
+ */
+syntax = 'proto3';
+
+import /* inline */ "foo" "/bar.proto";
+
+option a = "quote \" and \\ backslash";
+option b = 'single "double" \'single\'';
+option c = "\x41\101é\U0001F600\n";
+option d = "con" 'cat' "enation";
+`
+
+func TestLiterals(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "literals.proto", strings.NewReader(literals), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Syntax != ast.Proto3 {
+		t.Error("The syntax should be proto3")
+	}
+
+	path := f.Nodes[0].(*ast.Import).Path
+	if path.Value != `"foo" "/bar.proto"` || path.Decoded != "foo/bar.proto" {
+		t.Errorf("unexpected import path %s (%q)", path.Value, path.Decoded)
+	}
+	if end := fset.Position(path.End()).String(); end != "literals.proto:6:39" {
+		t.Errorf("expected end literals.proto:6:39, got %s", end)
+	}
+
+	for i, expected := range []string{
+		`quote " and \ backslash`,
+		`single "double" 'single'`,
+		"AAé😀\n",
+		"concatenation",
+	} {
+		lit := f.Nodes[i+1].(*ast.Option).Constant.(*ast.BasicLit)
+		if lit.Decoded != expected {
+			t.Errorf("expected %q, got %q", expected, lit.Decoded)
+		}
+	}
+}
+
+func TestLiteralErrors(t *testing.T) {
+	for _, src := range []string{
+		`option a = "unterminated;`,
+		`option a = "bad \q escape";`,
+		`option a = "bad \xZZ escape";`,
+		`option a = "\777";`,
+		`/* unterminated comment`,
+		`option a = { b [1, 2] };`,
+		`option a = { b 1 };`,
+		// Identifiers and numbers are ASCII only
+		`syntax = "proto3"; message A { int32 ٣ = 1; }`,
+		`syntax = "proto3"; message é {}`,
+	} {
+		fset := token.NewFileSet()
+		if _, err := ParseFile(fset, "", strings.NewReader(src), 0); err == nil {
+			t.Errorf("expected an error for %s", src)
+		}
+	}
+}
+
+const numbers = `syntax = "proto3";
+
+option (a) = 0x1F;
+option (b) = 017;
+option (c) = 1.5e10;
+option (d) = .5;
+option (e) = -inf;
+option (f) = nan;
+option (g) = -9223372036854775808;
+option (h) = 18446744073709551615;
+option (i) = 1E-3;
+
+enum Foo {
+  FOO = -1;
+  BAR = 0x7FFFFFFF;
+  BAZ = -2147483648;
+  QUX = - 1;
+  QUUX = + /* sign */ 2;
+  reserved -10 to - 5;
+}
+
+message Bar {
+  int32 baz = 0x10;
+}
+`
+
+func TestNumbers(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "numbers.proto", strings.NewReader(numbers), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tc := range []struct {
+		kind  token.Token
+		value string
+	}{
+		{token.INT, "0x1F"},
+		{token.INT, "017"},
+		{token.FLOAT, "1.5e10"},
+		{token.FLOAT, ".5"},
+		{token.FLOAT, "-inf"},
+		{token.FLOAT, "nan"},
+		{token.INT, "-9223372036854775808"},
+		{token.INT, "18446744073709551615"},
+		{token.FLOAT, "1E-3"},
+	} {
+		lit := f.Nodes[i].(*ast.Option).Constant.(*ast.BasicLit)
+		if lit.Kind != tc.kind || lit.Value != tc.value {
+			t.Errorf("option %d: expected %s, got %s", i, tc.value, lit.Value)
+		}
+	}
+
+	enum := f.Nodes[9].(*ast.Enum)
+	for i, expected := range []string{"-1", "0x7FFFFFFF", "-2147483648", "-1", "+2"} {
+		if v := enum.Body[i].(*ast.EnumField).Value; v != expected {
+			t.Errorf("expected enum value %s, got %s", expected, v)
+		}
+	}
+	// A sign may be separated from its number
+	if pos := fset.Position(enum.Body[3].(*ast.EnumField).ValuePos); pos.String() != "numbers.proto:17:9" {
+		t.Errorf("expected QUX value at numbers.proto:17:9, got %s", pos)
+	}
+	r := enum.Body[5].(*ast.Reserved).Ranges[0]
+	if high := r.High.(*ast.BasicLit); r.Low.Decoded != "-10" || high.Value != "- 5" || high.Decoded != "-5" {
+		t.Errorf("expected reserved -10 to - 5, got %s to %s", r.Low.Value, high.Value)
+	}
+
+	// The literal of a separated sign spans the source text
+	src := `option x = - /* sign */ 1;`
+	signed, err := ParseFile(fset, "sign.proto", strings.NewReader(src), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lit := signed.Nodes[0].(*ast.Option).Constant.(*ast.BasicLit)
+	if lit.Value != "- /* sign */ 1" || lit.Decoded != "-1" {
+		t.Errorf("expected - /* sign */ 1 decoded as -1, got %s (%s)", lit.Value, lit.Decoded)
+	}
+	if end := fset.Position(lit.End()).String(); end != "sign.proto:1:26" {
+		t.Errorf("expected the literal to end at sign.proto:1:26, got %s", end)
+	}
+	if n := f.Nodes[10].(*ast.Message).Body[0].(*ast.MessageField).Number.Value; n != "0x10" {
+		t.Errorf("expected field number 0x10, got %s", n)
+	}
+}
+
+func TestNumberErrors(t *testing.T) {
+	for _, src := range []string{
+		`option (a) = 09;`,
+		`option (a) = 0x;`,
+		`option (a) = 1e;`,
+		`option (a) = 12abc;`,
+		`option (a) = -;`,
+		`option (a) = -foo;`,
+		`enum Foo { FOO = - BAR; }`,
+		`option (a) = 18446744073709551616;`,
+		`option (a) = -9223372036854775809;`,
+		`enum Foo { FOO = 2147483648; }`,
+		`message Foo { int32 bar = 4294967296; }`,
+	} {
+		fset := token.NewFileSet()
+		if _, err := ParseFile(fset, "", strings.NewReader(src), 0); err == nil {
+			t.Errorf("expected an error for %s", src)
+		}
+	}
+}
+
+const comments = `// Copyright notice.
+
+syntax = "proto3";
+
+// Detached comment.
+
+/*
+ * Foo is a message.
+ */
+message Foo { // Foo line comment
+  // Bar is a field.
+  int32 bar = 1; // Bar line comment
+  // Trailing comment.
+}
+
+// Status is an enum.
+enum Status {
+  UNKNOWN = 0; // The default.
+}
+
+service Greeter {
+  // Greet says hello.
+  rpc Greet (Foo) returns (Foo); // Greet line comment
+}
+`
+
+func TestComments(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "comments.proto", strings.NewReader(comments), ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Comments) != 11 {
+		t.Errorf("expected 11 comment groups, got %d", len(f.Comments))
+	}
+
+	msg := f.Nodes[0].(*ast.Message)
+	if len(msg.Detached) != 1 || msg.Detached[0].Text() != "Detached comment.\n" {
+		t.Errorf("unexpected detached comments on Foo: %v", msg.Detached)
+	}
+	field := msg.Body[0].(*ast.MessageField)
+	enum := f.Nodes[1].(*ast.Enum)
+	rpc := f.Nodes[2].(*ast.Service).Body.List[0].(*ast.RPC)
+	for _, tc := range []struct {
+		name     string
+		group    *ast.CommentGroup
+		expected string
+	}{
+		{"Foo doc", msg.Doc, "Foo is a message.\n"},
+		{"Foo comment", msg.Comment, "Foo line comment\n"},
+		{"bar doc", field.Doc, "Bar is a field.\n"},
+		{"bar comment", field.Comment, "Bar line comment\n"},
+		{"Status doc", enum.Doc, "Status is an enum.\n"},
+		{"UNKNOWN comment", enum.Body[0].(*ast.EnumField).Comment, "The default.\n"},
+		{"Greet doc", rpc.Doc, "Greet says hello.\n"},
+		{"Greet comment", rpc.Comment, "Greet line comment\n"},
+	} {
+		if text := tc.group.Text(); text != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, text)
+		}
+	}
+
+	if pos := fset.Position(msg.Doc.Pos()); pos.String() != "comments.proto:7:1" {
+		t.Errorf("expected Foo doc at comments.proto:7:1, got %s", pos)
+	}
+
+	f, err = ParseFile(fset, "comments.proto", strings.NewReader(comments), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Comments != nil || f.Nodes[0].(*ast.Message).Doc != nil {
+		t.Error("expected no comments without ParseComments")
+	}
+}
+
+const recovery = `syntax = "proto3";
+
+message Foo {
+  int32 bar = ;
+  string baz = 2;
+  int32 qux 3;
+  message Nested { int32 a = 1 }
+  int32 last = 5;
+}
+
+enum Status {
+  UNKNOWN = zero;
+  OK = 1;
+}
+
+message { int32 skipped = 1; }
+
+service Greeter {
+  rpc Greet (Foo) returns Foo;
+}
+
+message After {}
+`
+
+func TestRecovery(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "recovery.proto", strings.NewReader(recovery), 0)
+	list, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("expected an ErrorList, got %v", err)
+	}
+
+	var positions []string
+	for _, e := range list {
+		positions = append(positions, e.Pos.String())
+	}
+	expected := []string{
+		"recovery.proto:4:15",
+		"recovery.proto:6:13",
+		"recovery.proto:7:32",
+		"recovery.proto:12:13",
+		"recovery.proto:16:9",
+		"recovery.proto:19:27",
+	}
+	if strings.Join(positions, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected errors at %v, got %v", expected, positions)
+	}
+
+	if len(f.Nodes) != 4 {
+		t.Fatalf("expected 4 nodes, got %d", len(f.Nodes))
+	}
+	foo := f.Nodes[0].(*ast.Message)
+	var names []string
+	for _, n := range foo.Body {
+		switch n := n.(type) {
+		case *ast.MessageField:
+			names = append(names, n.Name.Name)
+		case *ast.Message:
+			names = append(names, n.Name.Name)
+		}
+	}
+	if strings.Join(names, " ") != "baz Nested last" {
+		t.Errorf("expected baz, Nested and last, got %v", names)
+	}
+	if body := f.Nodes[1].(*ast.Enum).Body; len(body) != 1 {
+		t.Errorf("expected 1 enum value, got %d", len(body))
+	}
+	if name := f.Nodes[3].(*ast.Message).Name.Name; name != "After" {
+		t.Errorf("expected message After, got %s", name)
+	}
+}
+
+func TestRecoveryUnterminated(t *testing.T) {
+	src := `syntax = "proto3"; message A {} message M { int32 a = 1; message N {} enum E { X = 0;`
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "edit.proto", strings.NewReader(src), 0)
+	if err == nil || !strings.Contains(err.Error(), "edit.proto:1:86: expected }, found EOF") {
+		t.Errorf("expected an error at the end of the input, got %v", err)
+	}
+	if len(f.Nodes) != 2 {
+		t.Fatalf("expected 2 nodes, got %d", len(f.Nodes))
+	}
+	m := f.Nodes[1].(*ast.Message)
+	if m.Closing.IsValid() || len(m.Body) != 3 {
+		t.Fatalf("expected an unclosed message with 3 statements, got %d", len(m.Body))
+	}
+	if e := m.Body[2].(*ast.Enum); e.Closing.IsValid() || len(e.Body) != 1 || m.End() != e.End() {
+		t.Errorf("expected an unclosed enum ending the message")
+	}
+
+	// Every kind of block keeps what was parsed before the end of the input
+	for _, src := range []string{
+		`enum E { X = 0;`,
+		`extend A { optional int32 b = 2;`,
+		`message M { oneof o { int32 b = 2;`,
+		`message M { optional group G = 1 { optional int32 b = 2;`,
+		`service S { rpc R (A) returns (A) { option deprecated = true;`,
+	} {
+		fset := token.NewFileSet()
+		f, err := ParseFile(fset, "", strings.NewReader(src), 0)
+		if err == nil || len(f.Nodes) != 1 {
+			t.Errorf("%s: expected an error and 1 node, got %v", src, err)
+			continue
+		}
+		if n := f.Nodes[0]; int(n.End()) != fset.File(n.Pos()).Base()+len(src) {
+			t.Errorf("%s: expected the node to end with the input, got %s", src, fset.Position(n.End()))
+		}
+	}
+}
+
+func TestRecoveryTerminates(t *testing.T) {
+	src, err := ioutil.ReadFile(filepath.Join("_protos", "awkward.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every truncation of a valid file must parse to completion
+	for i := range src {
+		fset := token.NewFileSet()
+		ParseFile(fset, "awkward.proto", strings.NewReader(string(src[:i])), 0)
+	}
+}
+
+const keywords = `syntax = "proto3";
+
+package foo.message;
+
+import public "other.proto";
+
+message service {
+  string option = 1;
+  map syntax = 2;
+  map<string, returns> package = 3;
+  repeated stream import = 4;
+  .foo.message.enum rpc = 5;
+  bool true = 6 [deprecated = true];
+}
+
+message map {}
+message returns {}
+message stream {}
+
+enum enum {
+  map = 0;
+  option = 1;
+  reserved = 2;
+  message = 3;
+}
+
+service rpc {
+  rpc returns (stream) returns (stream stream);
+}
+`
+
+func TestKeywordIdents(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "keywords.proto", strings.NewReader(keywords), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := f.PackageName(); name != "foo.message" {
+		t.Errorf("expected package foo.message, got %s", name)
+	}
+
+	msg := f.Nodes[2].(*ast.Message)
+	for i, expected := range []string{"option", "syntax", "package", "import", "rpc", "true"} {
+		if name := msg.Body[i].(*ast.MessageField).Name.Name; name != expected {
+			t.Errorf("expected field %s, got %s", expected, name)
+		}
+	}
+	if _, ok := msg.Body[1].(*ast.MessageField).Type.(*ast.Ident); !ok {
+		t.Error("expected a field of message type map")
+	}
+	if _, ok := msg.Body[2].(*ast.MessageField).Type.(*ast.MapType); !ok {
+		t.Error("expected a map field")
+	}
+	if lit := msg.Body[5].(*ast.MessageField).Options[0].Constant.(*ast.BasicLit); lit.Kind != token.BOOL {
+		t.Errorf("expected a bool option value, got %s", lit.Kind)
+	}
+
+	enum := f.Nodes[6].(*ast.Enum)
+	for i, expected := range []string{"map", "option", "reserved", "message"} {
+		if name := enum.Body[i].(*ast.EnumField).Name.Name; name != expected {
+			t.Errorf("expected enum value %s, got %s", expected, name)
+		}
+	}
+
+	rpc := f.Nodes[7].(*ast.Service).Body.List[0].(*ast.RPC)
+	if rpc.Name.Name != "returns" || rpc.ClientStreaming || !rpc.ServerStreaming {
+		t.Errorf("unexpected rpc %s", rpc.Name.Name)
+	}
+}
+
+func TestParseDir(t *testing.T) {
+	for _, mode := range []Mode{0, ParseConcurrently} {
+		fset := token.NewFileSet()
+		pkgs, err := ParseDir(fset, wellKnownDir, nil, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pkgs) != 2 {
+			t.Fatalf("expected 2 packages, got %d", len(pkgs))
+		}
+		if n := len(pkgs["google.protobuf"].Files); n != 11 {
+			t.Errorf("expected 11 files in google.protobuf, got %d", n)
+		}
+		if n := len(pkgs["google.protobuf.compiler"].Files); n != 1 {
+			t.Errorf("expected 1 file in google.protobuf.compiler, got %d", n)
+		}
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := ParseDir(fset, "_protos", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := pkgs[""].Filenames(); len(names) != 1 || names[0] != filepath.Join("_protos", "awkward.proto") {
+		t.Errorf("expected awkward.proto without a package, got %v", names)
+	}
+
+	pkgs, err = ParseDir(fset, wellKnownDir, func(fi os.FileInfo) bool {
+		return strings.HasPrefix(fi.Name(), "a")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(pkgs["google.protobuf"].Files); n != 2 {
+		t.Errorf("expected 2 filtered files in google.protobuf, got %d", n)
+	}
+}
+
+func TestParseDirErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, src := range map[string]string{
+		"good.proto":      "package foo; message Good {}",
+		"sub/bad.proto":   "package foo; message Bad { int32 a = ; }",
+		"sub/other.proto": "package bar; message {}",
+		"sub/README":      "not a proto file",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := ParseDir(fset, dir, nil, ParseConcurrently)
+	list, ok := err.(ErrorList)
+	if !ok || len(list) != 2 {
+		t.Fatalf("expected 2 errors, got %v", err)
+	}
+	if list[0].Pos.Filename != filepath.Join(dir, "sub", "bad.proto") {
+		t.Errorf("expected the first error in bad.proto, got %s", list[0])
+	}
+	if len(pkgs["foo"].Files) != 2 || len(pkgs["bar"].Files) != 1 {
+		t.Errorf("expected files of packages foo and bar despite errors")
+	}
+
+	if _, err := ParseDir(fset, filepath.Join(dir, "missing"), nil, 0); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
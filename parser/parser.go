@@ -1,482 +1,1374 @@
 package parser
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/kyleconroy/pb/ast"
 	"github.com/kyleconroy/pb/token"
 )
 
+// A Mode value is a set of flags (or 0). They control the amount of source
+// code parsed and other optional parser functionality.
 type Mode int
 
+const (
+	ParseComments     Mode = 1 << iota // parse comments and add them to AST
+	ParseConcurrently                  // parse the files of ParseDir in parallel
+)
+
 func ParseFile(fset *token.FileSet, filename string, src io.Reader, mode Mode) (*ast.File, error) {
 	payload, err := ioutil.ReadAll(src)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: Use token.File for position information
 	f := fset.AddFile(filename, -1, len(payload))
 
-	t := tree{lex(f, filename, string(payload)), &ast.File{Nodes: []ast.Node{}}}
-	return t.parse()
+	t := tree{f: &ast.File{
+		FileStart: token.Pos(f.Base()),
+		FileEnd:   token.Pos(f.Base() + f.Size()),
+		Nodes:     []ast.Node{},
+	}}
+	t.l = lex(f, payload, func(pos token.Position, msg string) {
+		t.error(pos, msg)
+	})
+	if mode&ParseComments != 0 {
+		t.comments = newCommentMap()
+	}
+
+	file := t.parse()
+	if t.comments != nil {
+		ast.Walk(t.comments, file)
+	}
+	t.errors.Sort()
+	return file, t.errors.Err()
+}
+
+// ParseDir calls ParseFile for all files with names ending in ".proto" in
+// the directory tree rooted at path and returns a map of package name ->
+// package files with all the files found. Files that don't declare a
+// package are grouped under the empty name.
+//
+// If filter != nil, only the files with os.FileInfo entries passing through
+// the filter (and ending in ".proto") are considered. The mode bits are
+// passed to ParseFile unchanged; with ParseConcurrently, files are parsed
+// in parallel. Position information is recorded in fset, which must not be
+// nil.
+//
+// If the directory tree couldn't be read, a nil map and the respective
+// error are returned. If syntax errors were found, an incomplete map and
+// an ErrorList with the errors of all files, sorted by position, are
+// returned.
+func ParseDir(fset *token.FileSet, path string, filter func(os.FileInfo) bool, mode Mode) (map[string]*ast.PackageFiles, error) {
+	var filenames []string
+	err := filepath.Walk(path, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(name, ".proto") && (filter == nil || filter(info)) {
+			filenames = append(filenames, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*ast.File, len(filenames))
+	errs := make([]error, len(filenames))
+	if mode&ParseConcurrently != 0 {
+		work := make(chan int)
+		var wg sync.WaitGroup
+		for n := 0; n < runtime.NumCPU(); n++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range work {
+					files[i], errs[i] = parseFile(fset, filenames[i], mode)
+				}
+			}()
+		}
+		for i := range filenames {
+			work <- i
+		}
+		close(work)
+		wg.Wait()
+	} else {
+		for i, name := range filenames {
+			files[i], errs[i] = parseFile(fset, name, mode)
+		}
+	}
+
+	pkgs := map[string]*ast.PackageFiles{}
+	var list ErrorList
+	for i := range filenames {
+		if errs[i] != nil {
+			el, ok := errs[i].(ErrorList)
+			if !ok {
+				return nil, errs[i]
+			}
+			list = append(list, el...)
+		}
+		name := files[i].PackageName()
+		pkg, found := pkgs[name]
+		if !found {
+			pkg = &ast.PackageFiles{Name: name, Files: map[string]*ast.File{}}
+			pkgs[name] = pkg
+		}
+		pkg.Files[filenames[i]] = files[i]
+	}
+	list.Sort()
+	return pkgs, list.Err()
+}
+
+// parseFile opens and parses the named file.
+func parseFile(fset *token.FileSet, filename string, mode Mode) (*ast.File, error) {
+	src, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return ParseFile(fset, filename, src, mode)
 }
 
 type tree struct {
-	l *lexer
-	f *ast.File
+	l         *lexer
+	f         *ast.File
+	token     [1]item // one-token lookahead for parser
+	peekCount int
+	comments  *commentMap // nil unless parsing comments
+	depth     int         // number of enclosing blocks
+	errors    ErrorList
 }
 
+// error records an error at pos and returns it. Only the first error on a
+// line is recorded, since later ones are usually caused by the first.
+func (t *tree) error(pos token.Position, msg string) error {
+	err := &Error{Pos: pos, Msg: msg}
+	if n := len(t.errors); n == 0 || t.errors[n-1].Pos.Line != pos.Line {
+		t.errors = append(t.errors, err)
+	}
+	return err
+}
+
+// errorf records an error at the position of tok and returns it.
 func (t *tree) errorf(tok item, msg string, args ...interface{}) error {
-	prefix := fmt.Sprintf("%s:%d ", t.l.name, t.l.file.Line(token.Pos(tok.pos)))
-	return fmt.Errorf(prefix+msg, args...)
+	return t.error(t.l.file.Position(t.pos(tok)), fmt.Sprintf(msg, args...))
+}
+
+// sync skips the remainder of a statement after a syntax error, so that
+// parsing can continue with the next one. A statement ends at a semicolon
+// or with a complete block; the closing brace of an enclosing block is
+// left for that block. sync reports false if the input is exhausted.
+func (t *tree) sync() bool {
+	depth := 0
+	if t.peekCount == 0 {
+		// The last token returned may already end the statement
+		switch t.token[0].typ {
+		case token.SEMICOLON:
+			return true
+		case token.RBRACE:
+			if t.depth > 0 {
+				t.backup()
+			}
+			return true
+		case token.LBRACE:
+			depth++
+		case token.EOF:
+			t.backup()
+			return false
+		}
+	}
+	for {
+		switch tok := t.nextNonComment(); tok.typ {
+		case token.SEMICOLON:
+			if depth == 0 {
+				return true
+			}
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 && t.depth > 0 {
+				t.backup()
+				return true
+			}
+			if depth--; depth <= 0 {
+				return true
+			}
+		case token.EOF:
+			t.backup()
+			return false
+		}
+	}
+}
+
+// pos returns the file set position of the given item.
+func (t *tree) pos(tok item) token.Pos {
+	return t.l.file.Pos(int(tok.pos))
+}
+
+// ident returns an identifier node for the given item.
+func (t *tree) ident(tok item) *ast.Ident {
+	return &ast.Ident{NamePos: t.pos(tok), Name: tok.val}
+}
+
+// lit returns a literal node of the given kind for the given item.
+func (t *tree) lit(kind token.Token, tok item) *ast.BasicLit {
+	return &ast.BasicLit{ValuePos: t.pos(tok), Kind: kind, Value: tok.val}
+}
+
+// int32Lit returns an integer literal node for the number starting at tok,
+// checking that the value fits in a signed 32-bit integer.
+func (t *tree) int32Lit(tok item) (*ast.BasicLit, error) {
+	lit := t.number(tok)
+	if lit == nil || lit.Kind != token.INT {
+		return nil, t.errorf(tok, "expected integer, found %s", tok)
+	}
+	if _, err := strconv.ParseInt(lit.Decoded, 0, 32); err != nil {
+		return nil, t.errorf(tok, "integer out of range: %s", lit.Value)
+	}
+	return lit, nil
 }
 
-func (t *tree) expect(typs ...itemType) ([]item, error) {
+// number returns a literal node for the number starting at tok, or nil if
+// tok doesn't start one. The number may follow a sign, separated by spaces
+// or comments as in - 1; the literal spans both, and its Decoded value is
+// the number with its sign, e.g. -1. The values inf and nan are floats.
+func (t *tree) number(tok item) *ast.BasicLit {
+	sign, num := "", tok
+	if tok.typ == token.ADD || tok.typ == token.SUB {
+		sign, num = tok.val, t.nextNonComment()
+	}
+	kind := num.typ
+	switch {
+	case num.typ == token.INT, num.typ == token.FLOAT:
+	case num.typ == token.IDENT && (num.val == "inf" || num.val == "nan"):
+		kind = token.FLOAT
+	default:
+		if sign != "" {
+			t.backup()
+		}
+		return nil
+	}
+	return &ast.BasicLit{
+		ValuePos: t.pos(tok),
+		Kind:     kind,
+		Value:    t.l.input[tok.pos : int(num.pos)+len(num.val)],
+		Decoded:  sign + num.val,
+	}
+}
+
+// parseString returns a string literal node for tok and any string literals
+// immediately following it, which are concatenated.
+func (t *tree) parseString(tok item) (*ast.BasicLit, error) {
+	last := tok
+	value := ""
+	for {
+		s, err := unquote(last.val)
+		if err != nil {
+			return nil, t.errorf(last, "%v", err)
+		}
+		value += s
+		if t.peek().typ != token.STRING {
+			break
+		}
+		last = t.nextNonComment()
+	}
+	return &ast.BasicLit{
+		ValuePos: t.pos(tok),
+		Kind:     token.STRING,
+		Value:    t.l.input[tok.pos : int(last.pos)+len(last.val)],
+		Decoded:  value,
+	}, nil
+}
+
+func (t *tree) expect(typs ...token.Token) ([]item, error) {
 	items := make([]item, len(typs))
 	for i, typ := range typs {
 		tok := t.nextNonComment()
-		if tok.typ == typ {
+		if tok.is(typ) {
 			items[i] = tok
 		} else {
-			return items, t.errorf(tok, "unexpected token: %s", tok.val)
+			return items, t.errorf(tok, "unexpected token: %s", tok)
 		}
 	}
 	return items, nil
 }
 
-func (t *tree) parse() (*ast.File, error) {
-	defer t.l.drain()
-
-	if err := t.parseSyntax(); err != nil {
-		return t.f, err
+// parse parses the whole file. Errors are recorded in t.errors; after an
+// error the parser skips to the next statement and continues, so the
+// returned file holds every statement that could be parsed.
+func (t *tree) parse() *ast.File {
+	if err := t.parseSyntax(); err != nil && !t.sync() {
+		return t.f
 	}
 
 	for {
-		switch token := t.nextNonComment(); {
-		case token.typ == itemImport:
-			if err := t.parseImport(); err != nil {
-				return t.f, err
-			}
-		case token.typ == itemPackage:
-			if err := t.parsePackage(); err != nil {
-				return t.f, err
-			}
-		case token.typ == itemOption:
-			if err := t.parseOption(); err != nil {
-				return t.f, err
-			}
-		case token.typ == itemMessage:
-			node, err := t.parseMessage()
-			if err != nil {
-				return t.f, err
-			}
-			t.f.Nodes = append(t.f.Nodes, node)
-		case token.typ == itemService:
-			node, err := t.parseService(token)
-			if err != nil {
-				return t.f, err
-			}
-			t.f.Nodes = append(t.f.Nodes, node)
-		case token.typ == itemEnum:
-			node, err := t.parseEnum()
-			if err != nil {
-				return t.f, err
-			}
-			t.f.Nodes = append(t.f.Nodes, node)
-		case token.typ == itemSemiColon:
+		var node ast.Node
+		var err error
+		switch tok := t.nextNonComment(); {
+		case tok.is(token.IMPORT):
+			err = t.parseImport(tok)
+		case tok.is(token.PACKAGE):
+			err = t.parsePackage(tok)
+		case tok.is(token.OPTION):
+			node, err = t.parseOption(tok)
+		case tok.is(token.MESSAGE):
+			node, err = t.parseMessage(tok)
+		case tok.is(token.SERVICE):
+			node, err = t.parseService(tok)
+		case tok.is(token.ENUM):
+			node, err = t.parseEnum(tok)
+		case tok.is(token.EXTEND):
+			node, err = t.parseExtend(tok)
+		case tok.typ == token.SEMICOLON:
 			// No action
-		case token.typ == itemError:
-			return t.f, errors.New(token.val)
-		case token.typ == itemEOF:
-			return t.f, nil
+		case tok.typ == token.EOF:
+			return t.f
 		default:
-			return t.f, t.errorf(token, "unexpected token: %s", token.val)
+			err = t.errorf(tok, "unexpected token: %s", tok)
+		}
+		if err != nil {
+			if !t.sync() {
+				return t.f
+			}
+			continue
+		}
+		if node != nil {
+			t.f.Nodes = append(t.f.Nodes, node)
 		}
 	}
-
-	return t.f, nil
 }
 
 func (t *tree) parseSyntax() error {
-	toks, err := t.expect(itemSyntax, itemEq, itemStrLit, itemSemiColon)
+	tok := t.nextNonComment()
+	isEdition := tok.is(token.EDITION)
+	if !tok.is(token.SYNTAX) && !isEdition {
+		// Files without a syntax statement are proto2
+		t.backup()
+		t.f.Syntax = ast.Proto2
+		return nil
+	}
+
+	toks, err := t.expect(token.ASSIGN, token.STRING)
+	if err != nil {
+		return err
+	}
+	lit, err := t.parseString(toks[1])
 	if err != nil {
 		return err
 	}
-	if toks[2].val != "\"proto3\"" {
-		return fmt.Errorf("Looking for proto3")
+	if _, err := t.expect(token.SEMICOLON); err != nil {
+		return err
+	}
+
+	switch {
+	case isEdition:
+		t.f.Syntax = ast.Editions
+		t.f.Edition = lit.Decoded
+	case lit.Decoded == "proto2":
+		t.f.Syntax = ast.Proto2
+	case lit.Decoded == "proto3":
+		t.f.Syntax = ast.Proto3
+	default:
+		return t.errorf(toks[1], "unknown syntax: %s", lit.Value)
 	}
-	t.f.Syntax = ast.Proto3
 	return nil
 }
 
-func (t *tree) parsePackage() error {
-	for {
-		item := t.nextNonComment()
-		if item.typ == itemSemiColon {
-			break
-		}
+func (t *tree) parsePackage(in item) error {
+	if t.f.Package() != nil {
+		return t.errorf(in, "multiple package definitions")
+	}
+	tok := t.nextNonComment()
+	name, err := t.parseTypeName(tok)
+	if err != nil {
+		return err
+	}
+	if full, ok := name.(*ast.FullIdent); ok && full.Absolute {
+		return t.errorf(tok, "package names may not start with a dot")
+	}
+	end, err := t.expect(token.SEMICOLON)
+	if err != nil {
+		return err
 	}
-	t.f.Nodes = append(t.f.Nodes, &ast.Package{})
+	t.f.Nodes = append(t.f.Nodes, &ast.Package{
+		Package:   t.pos(in),
+		Name:      name,
+		Semicolon: t.pos(end[0]),
+	})
 	return nil
 }
 
-func (t *tree) parseImport() error {
+func (t *tree) parseImport(in item) error {
 	idents := []*ast.Ident{}
-	seen := map[itemType]struct{}{}
+	seen := map[string]struct{}{}
 	for {
 		switch tok := t.nextNonComment(); {
-		case tok.typ == itemImportPublic || tok.typ == itemImportWeak:
-			if _, ok := seen[tok.typ]; ok {
-				return fmt.Errorf("Multiple %s modifiers found", tok.val)
+		case tok.is(token.PUBLIC) || tok.is(token.WEAK):
+			if _, ok := seen[tok.val]; ok {
+				return t.errorf(tok, "multiple %s modifiers found", tok.val)
 			}
-			seen[tok.typ] = struct{}{}
-			idents = append(idents, &ast.Ident{Name: tok.val})
-		case tok.typ == itemStrLit:
-			if end := t.nextNonComment(); end.typ != itemSemiColon {
-				return fmt.Errorf("Incorrect token: %s", end)
+			seen[tok.val] = struct{}{}
+			idents = append(idents, t.ident(tok))
+		case tok.typ == token.STRING:
+			path, err := t.parseString(tok)
+			if err != nil {
+				return err
+			}
+			end := t.nextNonComment()
+			if end.typ != token.SEMICOLON {
+				return t.errorf(end, "unexpected token: %s", end)
 			}
 			t.f.Nodes = append(t.f.Nodes, &ast.Import{
+				Import:    t.pos(in),
 				Modifiers: idents,
-				Path:      &ast.BasicLit{Value: tok.val, Kind: token.STRING},
+				Path:      path,
+				Semicolon: t.pos(end),
 			})
 			return nil
 		default:
-			return fmt.Errorf("Incorrect token: %s", tok)
+			return t.errorf(tok, "unexpected token: %s", tok)
 		}
 	}
-	return nil
 }
 
-func (t *tree) parseOption() error {
-	var ident item
+// parseOption parses an option statement after the option keyword.
+func (t *tree) parseOption(in item) (*ast.Option, error) {
+	opt, err := t.parseOptionAssignment()
+	if err != nil {
+		return nil, err
+	}
+	end := t.nextNonComment()
+	if end.typ != token.SEMICOLON {
+		return nil, t.errorf(end, "unexpected token: %s", end)
+	}
+	opt.Option = t.pos(in)
+	opt.Semicolon = t.pos(end)
+	return opt, nil
+}
+
+// parseOptionAssignment parses the dotted option name, the equals sign and
+// the constant value of an option.
+func (t *tree) parseOptionAssignment() (*ast.Option, error) {
+	opt := ast.Option{}
+	for {
+		name, err := t.parseOptionName()
+		if err != nil {
+			return nil, err
+		}
+		opt.Names = append(opt.Names, name)
 
+		tok := t.nextNonComment()
+		if tok.typ == token.ASSIGN {
+			break
+		}
+		if tok.typ != token.PERIOD {
+			return nil, t.errorf(tok, "expected = or ., found %s", tok)
+		}
+	}
+
+	con, err := t.parseConstant()
+	if err != nil {
+		return nil, err
+	}
+	opt.Constant = con
+	return &opt, nil
+}
+
+// parseOptionName parses one part of an option name, which is either a
+// simple identifier or a dotted extension name in parentheses.
+func (t *tree) parseOptionName() (*ast.OptionName, error) {
 	tok := t.nextNonComment()
-	// TODO We need to handle full idents
-	if tok.typ != itemIdent {
-		return fmt.Errorf("expected ident, found %s", tok)
+	switch tok.typ {
+	case token.IDENT:
+		return &ast.OptionName{Name: t.ident(tok)}, nil
+	case token.LPAREN:
+	default:
+		return nil, t.errorf(tok, "expected option name, found %s", tok)
 	}
-	ident = tok
 
-	tok = t.nextNonComment()
-	// TODO We need to handle full idents
-	if tok.typ != itemEq {
-		return fmt.Errorf("expected =, found %s", tok)
+	name, err := t.parseTypeName(t.nextNonComment())
+	if err != nil {
+		return nil, err
 	}
+	toks, err := t.expect(token.RPAREN)
+	if err != nil {
+		return nil, err
+	}
+	return &ast.OptionName{
+		Lparen:    t.pos(tok),
+		Name:      name,
+		Rparen:    t.pos(toks[0]),
+		Extension: true,
+	}, nil
+}
 
-	tok = t.nextNonComment()
-	var con ast.BasicLit
-	// TODO We need to handle all constant types
+// parseTypeName parses a possibly qualified name starting at tok. Simple
+// names are returned as an *ast.Ident, all others as an *ast.FullIdent.
+func (t *tree) parseTypeName(tok item) (ast.Node, error) {
+	name := ast.FullIdent{}
+	if tok.typ == token.PERIOD {
+		name.Dot = t.pos(tok)
+		name.Absolute = true
+		tok = t.nextNonComment()
+	}
+	for {
+		if tok.typ != token.IDENT {
+			return nil, t.errorf(tok, "expected identifier, found %s", tok)
+		}
+		name.Parts = append(name.Parts, t.ident(tok))
+		if t.peek().typ != token.PERIOD {
+			break
+		}
+		t.nextNonComment()
+		tok = t.nextNonComment()
+	}
+	if !name.Absolute && len(name.Parts) == 1 {
+		return name.Parts[0], nil
+	}
+	return &name, nil
+}
+
+// parseConstant parses a scalar constant, an enum value identifier or an
+// aggregate value in braces.
+func (t *tree) parseConstant() (ast.Node, error) {
+	tok := t.nextNonComment()
+	if lit := t.number(tok); lit != nil {
+		if lit.Kind != token.INT {
+			return lit, nil
+		}
+		// Negative values must fit in an int64, all others in a uint64
+		var err error
+		if strings.HasPrefix(lit.Decoded, "-") {
+			_, err = strconv.ParseInt(lit.Decoded, 0, 64)
+		} else {
+			_, err = strconv.ParseUint(strings.TrimPrefix(lit.Decoded, "+"), 0, 64)
+		}
+		if err != nil {
+			return nil, t.errorf(tok, "integer out of range: %s", lit.Value)
+		}
+		return lit, nil
+	}
 	switch tok.typ {
-	case itemStrLit:
-		con = ast.BasicLit{Value: tok.val, Kind: token.STRING}
-	case itemBoolLit:
-		con = ast.BasicLit{Value: tok.val, Kind: token.BOOL}
+	case token.STRING:
+		return t.parseString(tok)
+	case token.IDENT:
+		if tok.val == "true" || tok.val == "false" {
+			return t.lit(token.BOOL, tok), nil
+		}
+		return t.parseTypeName(tok)
+	case token.LBRACE:
+		return t.parseMessageLit(tok)
 	default:
-		return fmt.Errorf("expected string literal, found %s", tok)
+		return nil, t.errorf(tok, "expected constant, found %s", tok)
 	}
+}
 
-	if end := t.nextNonComment(); end.typ != itemSemiColon {
-		return fmt.Errorf("Incorrect token: %s", end)
+// parseMessageLit parses an aggregate value written in the protobuf text
+// format, after the opening brace or angle bracket.
+func (t *tree) parseMessageLit(open item) (*ast.MessageLit, error) {
+	closing := token.RBRACE
+	if open.typ == token.LSS {
+		closing = token.GTR
 	}
+	lit := ast.MessageLit{Opening: t.pos(open)}
+	for {
+		switch tok := t.nextNonComment(); tok.typ {
+		case closing:
+			lit.Closing = t.pos(tok)
+			return &lit, nil
+		case token.COMMA, token.SEMICOLON:
+			// Fields may optionally be separated
+		default:
+			t.backup()
+			field, err := t.parseFieldLit()
+			if err != nil {
+				return nil, err
+			}
+			lit.Fields = append(lit.Fields, field)
+		}
+	}
+}
 
-	t.f.Nodes = append(t.f.Nodes, &ast.Option{
-		Names: []*ast.Ident{
-			{Name: ident.val},
-		},
-		Constant: &con,
-	})
-	return nil
+// parseFieldLit parses a single field of an aggregate value. The colon
+// after the field name is optional when the value is a message or a list of
+// messages.
+func (t *tree) parseFieldLit() (*ast.FieldLit, error) {
+	field := ast.FieldLit{}
+	switch tok := t.nextNonComment(); {
+	case tok.typ == token.LBRACK:
+		// The type name of an Any value follows a URL prefix, as in
+		// [type.googleapis.com/pkg.Msg]
+		var prefix []string
+		name, err := t.parseTypeName(t.nextNonComment())
+		for err == nil && t.peek().typ == token.QUO {
+			prefix = append(prefix, name.(fmt.Stringer).String())
+			t.nextNonComment()
+			name, err = t.parseTypeName(t.nextNonComment())
+		}
+		if err != nil {
+			return nil, err
+		}
+		toks, err := t.expect(token.RBRACK)
+		if err != nil {
+			return nil, err
+		}
+		field.Lbrack = t.pos(tok)
+		field.Prefix = strings.Join(prefix, "/")
+		field.Name = name
+		field.Rbrack = t.pos(toks[0])
+		field.Extension = true
+	case tok.typ == token.IDENT:
+		field.Name = t.ident(tok)
+	default:
+		return nil, t.errorf(tok, "expected field name, found %s", tok)
+	}
+
+	tok := t.nextNonComment()
+	if tok.typ == token.COLON {
+		field.Colon = t.pos(tok)
+		tok = t.nextNonComment()
+	}
+
+	var err error
+	switch {
+	case tok.typ == token.LBRACE || tok.typ == token.LSS:
+		field.Value, err = t.parseMessageLit(tok)
+	case tok.typ == token.LBRACK:
+		field.Value, err = t.parseListLit(tok, !field.Colon.IsValid())
+	case !field.Colon.IsValid():
+		return nil, t.errorf(tok, "expected :, found %s", tok)
+	default:
+		t.backup()
+		field.Value, err = t.parseConstant()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &field, nil
+}
+
+// parseListLit parses a comma-separated list of values in an aggregate
+// value, after the opening bracket. If messages is set, the values must be
+// messages.
+func (t *tree) parseListLit(open item, messages bool) (*ast.ListLit, error) {
+	lit := ast.ListLit{Opening: t.pos(open)}
+	if tok := t.nextNonComment(); tok.typ == token.RBRACK {
+		lit.Closing = t.pos(tok)
+		return &lit, nil
+	}
+	t.backup()
+	for {
+		var value ast.Node
+		var err error
+		switch tok := t.nextNonComment(); {
+		case tok.typ == token.LBRACE || tok.typ == token.LSS:
+			value, err = t.parseMessageLit(tok)
+		case messages:
+			return nil, t.errorf(tok, "expected message, found %s", tok)
+		default:
+			t.backup()
+			value, err = t.parseConstant()
+		}
+		if err != nil {
+			return nil, err
+		}
+		lit.Values = append(lit.Values, value)
+
+		switch tok := t.nextNonComment(); tok.typ {
+		case token.COMMA:
+		case token.RBRACK:
+			lit.Closing = t.pos(tok)
+			return &lit, nil
+		default:
+			return nil, t.errorf(tok, "unexpected token: %s", tok)
+		}
+	}
 }
 
-func (t *tree) parseMessage() (ast.Node, error) {
+func (t *tree) parseMessage(in item) (ast.Node, error) {
 	name := t.nextNonComment()
-	if name.typ != itemIdent {
-		return nil, fmt.Errorf("expected ident, found %s", name)
+	if name.typ != token.IDENT {
+		return nil, t.errorf(name, "expected ident, found %s", name)
 	}
 	msg := ast.Message{
-		Name: &ast.Ident{Name: name.val},
-		Body: []ast.Node{},
+		Message: t.pos(in),
+		Name:    t.ident(name),
 	}
 
 	lBrace := t.nextNonComment()
-	if lBrace.typ != itemLeftBrace {
-		return nil, fmt.Errorf("expected {, found %s", lBrace)
+	if lBrace.typ != token.LBRACE {
+		return nil, t.errorf(lBrace, "expected {, found %s", lBrace)
 	}
+	msg.Opening = t.pos(lBrace)
+
+	msg.Body, msg.Closing = t.parseMessageBody()
+	return &msg, nil
+}
+
+// parseMessageBody parses the statements of a message or group up to and
+// including the closing brace, whose position it returns. If the input ends
+// first, it records an error and returns the statements parsed so far with
+// token.NoPos.
+func (t *tree) parseMessageBody() ([]ast.Node, token.Pos) {
+	t.depth++
+	defer func() { t.depth-- }()
 
+	body := []ast.Node{}
 	for {
+		var node ast.Node
+		var err error
 		switch tok := t.nextNonComment(); {
-		case tok.typ == itemSemiColon:
-			msg.Body = append(msg.Body, &ast.EmptyStmt{Semicolon: token.Pos(0)})
-		case tok.typ == itemOneOf:
-			nmsg, err := t.parseOneOf()
-			if err != nil {
-				return nil, err
+		case tok.typ == token.SEMICOLON:
+			node = &ast.EmptyStmt{Semicolon: t.pos(tok)}
+		case tok.is(token.ONEOF):
+			node, err = t.parseOneOf(tok)
+		case tok.is(token.MESSAGE):
+			node, err = t.parseMessage(tok)
+		case tok.is(token.ENUM):
+			node, err = t.parseEnum(tok)
+		case tok.is(token.OPTION):
+			node, err = t.parseOption(tok)
+		case tok.is(token.EXTENSIONS) && t.peek().typ == token.INT:
+			node, err = t.parseExtensions(tok)
+		case tok.is(token.RESERVED) && t.isReservation(t.peek()):
+			node, err = t.parseReserved(tok)
+		case tok.is(token.EXTEND):
+			node, err = t.parseExtend(tok)
+		case tok.is(token.REPEATED) || isLabel(tok):
+			node, err = t.parseField(t.ident(tok), t.nextNonComment())
+		case tok.typ == token.IDENT || tok.typ == token.PERIOD:
+			node, err = t.parseField(nil, tok)
+		case tok.typ == token.RBRACE:
+			return body, t.pos(tok)
+		case tok.typ == token.EOF:
+			t.errorf(tok, "expected }, found %s", tok)
+			return body, token.NoPos
+		default:
+			err = t.errorf(tok, "unexpected token in message: %s", tok)
+		}
+		if err != nil {
+			t.sync()
+			continue
+		}
+		body = append(body, node)
+	}
+}
+
+// parseExtend parses an extend block after the extend keyword. The body
+// holds the extension fields of the target message.
+func (t *tree) parseExtend(in item) (ast.Node, error) {
+	typ, err := t.parseTypeName(t.nextNonComment())
+	if err != nil {
+		return nil, err
+	}
+	lBrace, err := t.expect(token.LBRACE)
+	if err != nil {
+		return nil, err
+	}
+	ext := ast.Extend{
+		Extend:  t.pos(in),
+		Type:    typ,
+		Opening: t.pos(lBrace[0]),
+		Body:    []ast.Node{},
+	}
+
+	t.depth++
+	defer func() { t.depth-- }()
+
+	for {
+		var node ast.Node
+		var err error
+		switch tok := t.nextNonComment(); {
+		case tok.typ == token.SEMICOLON:
+			node = &ast.EmptyStmt{Semicolon: t.pos(tok)}
+		case tok.is(token.REPEATED) || isLabel(tok):
+			node, err = t.parseField(t.ident(tok), t.nextNonComment())
+		case tok.typ == token.IDENT || tok.typ == token.PERIOD:
+			node, err = t.parseField(nil, tok)
+		case tok.typ == token.RBRACE:
+			ext.Closing = t.pos(tok)
+			return &ext, nil
+		case tok.typ == token.EOF:
+			t.errorf(tok, "expected }, found %s", tok)
+			return &ext, nil
+		default:
+			err = t.errorf(tok, "unexpected token in extend: %s", tok)
+		}
+		if err != nil {
+			t.sync()
+			continue
+		}
+		ext.Body = append(ext.Body, node)
+	}
+}
+
+// isLabel reports whether tok is one of the proto2 field labels.
+func isLabel(tok item) bool {
+	return tok.is(token.OPTIONAL) || tok.is(token.REQUIRED)
+}
+
+// parseField parses a normal, map or group field starting at its type, after
+// the optional label.
+func (t *tree) parseField(label *ast.Ident, tok item) (ast.Node, error) {
+	if label != nil && label.Name == "required" && t.f.Syntax == ast.Proto3 {
+		return nil, t.errorf(tok, "required fields are not allowed in proto3")
+	}
+	if label != nil && label.Name != "repeated" && t.f.Syntax == ast.Editions {
+		return nil, t.errorf(tok, "%s fields are not allowed in editions", label.Name)
+	}
+
+	var typ ast.Node
+	var err error
+	switch {
+	case tok.is(token.MAP) && t.peek().typ == token.LSS:
+		if typ, err = t.parseMapType(tok); err != nil {
+			return nil, err
+		}
+	case tok.typ == token.IDENT || tok.typ == token.PERIOD:
+		if typ, err = t.parseTypeName(tok); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, t.errorf(tok, "expected field type, found %s", tok)
+	}
+
+	toks, err := t.expect(token.IDENT, token.ASSIGN, token.INT)
+	if err != nil {
+		return nil, err
+	}
+
+	number, err := t.int32Lit(toks[2])
+	if err != nil {
+		return nil, err
+	}
+
+	field := ast.MessageField{
+		Label:  label,
+		Type:   typ,
+		Name:   t.ident(toks[0]),
+		Number: number,
+	}
+
+	tok = t.nextNonComment()
+	if tok.typ == token.LBRACK {
+		opts, err := t.parseCompactOptions()
+		if err != nil {
+			return nil, err
+		}
+		for _, opt := range opts {
+			// The default value is a field property, not a real option
+			if isDefault(opt) {
+				if t.f.Syntax == ast.Proto3 {
+					return nil, t.error(t.l.file.Position(opt.Pos()), "default values are not allowed in proto3")
+				}
+				field.Default = opt.Constant
+			} else {
+				field.Options = append(field.Options, opt)
 			}
-			msg.Body = append(msg.Body, nmsg)
-		case tok.typ == itemMessage:
-			nmsg, err := t.parseMessage()
-			if err != nil {
+		}
+		tok = t.nextNonComment()
+	}
+
+	switch {
+	case tok.typ == token.SEMICOLON:
+		field.Semicolon = t.pos(tok)
+		return &field, nil
+	case tok.typ == token.LBRACE && isGroup(typ):
+		if t.f.Syntax != ast.Proto2 {
+			return nil, t.errorf(tok, "groups are only allowed in proto2")
+		}
+		body, closing := t.parseMessageBody()
+		return &ast.Group{
+			Label:   label,
+			Group:   typ.Pos(),
+			Name:    field.Name,
+			Number:  field.Number,
+			Options: field.Options,
+			Opening: t.pos(tok),
+			Body:    body,
+			Closing: closing,
+		}, nil
+	default:
+		return nil, t.errorf(tok, "unexpected token: %s", tok)
+	}
+}
+
+// isDefault reports whether opt sets the default value of a field.
+func isDefault(opt *ast.Option) bool {
+	if len(opt.Names) != 1 || opt.Names[0].Extension {
+		return false
+	}
+	ident, ok := opt.Names[0].Name.(*ast.Ident)
+	return ok && ident.Name == "default"
+}
+
+// parseMapType parses a map type after the map keyword.
+func (t *tree) parseMapType(in item) (*ast.MapType, error) {
+	toks, err := t.expect(token.LSS, token.IDENT, token.COMMA)
+	if err != nil {
+		return nil, err
+	}
+	value, err := t.parseTypeName(t.nextNonComment())
+	if err != nil {
+		return nil, err
+	}
+	end, err := t.expect(token.GTR)
+	if err != nil {
+		return nil, err
+	}
+	return &ast.MapType{
+		Map:     t.pos(in),
+		Key:     t.ident(toks[1]),
+		Value:   value,
+		Closing: t.pos(end[0]),
+	}, nil
+}
+
+// isGroup reports whether typ is the group keyword.
+func isGroup(typ ast.Node) bool {
+	ident, ok := typ.(*ast.Ident)
+	return ok && ident.Name == "group"
+}
+
+// parseCompactOptions parses a comma-separated list of options enclosed in
+// brackets, after the opening bracket.
+func (t *tree) parseCompactOptions() ([]*ast.Option, error) {
+	opts := []*ast.Option{}
+	for {
+		opt, err := t.parseOptionAssignment()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
+
+		switch tok := t.nextNonComment(); tok.typ {
+		case token.COMMA:
+		case token.RBRACK:
+			return opts, nil
+		default:
+			return nil, t.errorf(tok, "unexpected token: %s", tok)
+		}
+	}
+}
+
+// parseExtensions parses an extensions statement after the extensions
+// keyword. The ranges may be followed by options in brackets.
+func (t *tree) parseExtensions(in item) (ast.Node, error) {
+	if t.f.Syntax == ast.Proto3 {
+		return nil, t.errorf(in, "extension ranges are not allowed in proto3")
+	}
+	ext := ast.Extensions{Extensions: t.pos(in)}
+	for {
+		r, err := t.parseRange()
+		if err != nil {
+			return nil, err
+		}
+		ext.Ranges = append(ext.Ranges, r)
+
+		tok := t.nextNonComment()
+		if tok.typ == token.LBRACK {
+			if ext.Options, err = t.parseCompactOptions(); err != nil {
 				return nil, err
 			}
-			msg.Body = append(msg.Body, nmsg)
-		case tok.typ == itemEnum:
-			nenum, err := t.parseEnum()
-			if err != nil {
-				return nil, err
+			if tok = t.nextNonComment(); tok.typ != token.SEMICOLON {
+				return nil, t.errorf(tok, "unexpected token: %s", tok)
 			}
-			msg.Body = append(msg.Body, nenum)
-		case tok.typ == itemOption:
-			// Should be constant here, not bool
-			toks, err := t.expect(itemIdent, itemEq, itemBoolLit, itemSemiColon)
-			if err != nil {
-				return nil, err
+		}
+		switch tok.typ {
+		case token.COMMA:
+		case token.SEMICOLON:
+			ext.Semicolon = t.pos(tok)
+			return &ext, nil
+		default:
+			return nil, t.errorf(tok, "unexpected token: %s", tok)
+		}
+	}
+}
+
+// isReservation reports whether tok can start the body of a reserved
+// statement. Editions name reserved fields with identifiers instead of
+// strings.
+func (t *tree) isReservation(tok item) bool {
+	switch tok.typ {
+	case token.INT, token.SUB, token.STRING:
+		return true
+	case token.IDENT:
+		return t.f.Syntax == ast.Editions
+	}
+	return false
+}
+
+// parseReserved parses a reserved statement after the reserved keyword. The
+// statement holds either field numbers and ranges or field names, which are
+// strings in proto2 and proto3 and identifiers in editions.
+func (t *tree) parseReserved(in item) (ast.Node, error) {
+	res := ast.Reserved{Reserved: t.pos(in)}
+	next := t.peek()
+	names := next.typ == token.STRING || next.typ == token.IDENT
+	for {
+		switch {
+		case names && t.f.Syntax == ast.Editions:
+			tok := t.nextNonComment()
+			if tok.typ == token.STRING {
+				return nil, t.errorf(tok, "reserved names must be identifiers in editions")
 			}
-			msg.Body = append(msg.Body, &ast.Option{
-				Names:    []*ast.Ident{{Name: toks[0].val}},
-				Constant: &ast.BasicLit{Kind: token.BOOL, Value: toks[2].val},
-			})
-		case tok.typ == itemRepeated:
-			toks, err := t.expect(itemIdent, itemIdent, itemEq, itemIntLit, itemSemiColon)
-			if err != nil {
-				return nil, err
+			if tok.typ != token.IDENT {
+				return nil, t.errorf(tok, "expected identifier, found %s", tok)
 			}
-			msg.Body = append(msg.Body, &ast.MessageField{
-				Repeated: &ast.Ident{Name: tok.val},
-				Type:     &ast.Ident{Name: toks[0].val},
-				Name:     &ast.Ident{Name: toks[1].val},
-				Number:   &ast.BasicLit{Kind: token.INT, Value: toks[3].val},
-			})
-		case tok.typ == itemIdent:
-			toks, err := t.expect(itemIdent, itemEq, itemIntLit, itemSemiColon)
+			res.Names = append(res.Names, t.ident(tok))
+		case names:
+			toks, err := t.expect(token.STRING)
 			if err != nil {
 				return nil, err
 			}
-			msg.Body = append(msg.Body, &ast.MessageField{
-				Type:   &ast.Ident{Name: tok.val},
-				Name:   &ast.Ident{Name: toks[0].val},
-				Number: &ast.BasicLit{Kind: token.INT, Value: toks[2].val},
-			})
-		case tok.typ == itemMap:
-			mapt, err := t.expect(itemLeftMap, itemIdent, itemComma, itemIdent, itemRightMap)
+			name, err := t.parseString(toks[0])
 			if err != nil {
 				return nil, err
 			}
-			toks, err := t.expect(itemIdent, itemEq, itemIntLit, itemSemiColon)
+			res.Names = append(res.Names, name)
+		default:
+			r, err := t.parseRange()
 			if err != nil {
 				return nil, err
 			}
-			msg.Body = append(msg.Body, &ast.MessageField{
-				Type: &ast.MapType{
-					Key:   &ast.Ident{Name: mapt[1].val},
-					Value: &ast.Ident{Name: mapt[3].val},
-				},
-				Name:   &ast.Ident{Name: toks[0].val},
-				Number: &ast.BasicLit{Kind: token.INT, Value: toks[2].val},
-			})
-		case tok.typ == itemRightBrace:
-			return &msg, nil
+			res.Ranges = append(res.Ranges, r)
+		}
+
+		switch tok := t.nextNonComment(); tok.typ {
+		case token.COMMA:
+		case token.SEMICOLON:
+			res.Semicolon = t.pos(tok)
+			return &res, nil
 		default:
-			return nil, fmt.Errorf("unexpected token in message: %s", tok)
+			return nil, t.errorf(tok, "unexpected token: %s", tok)
 		}
 	}
 }
 
-func (t *tree) parseOneOf() (ast.Node, error) {
+// parseRange parses a single number or a "from to end" range, where end
+// may be the max keyword.
+func (t *tree) parseRange() (*ast.Range, error) {
+	low, err := t.int32Lit(t.nextNonComment())
+	if err != nil {
+		return nil, err
+	}
+	r := ast.Range{Low: low}
+
+	tok := t.nextNonComment()
+	if !tok.is(token.TO) {
+		t.backup()
+		return &r, nil
+	}
+	r.To = t.pos(tok)
+
+	if tok := t.nextNonComment(); tok.is(token.MAX) {
+		r.High = t.ident(tok)
+	} else if r.High, err = t.int32Lit(tok); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (t *tree) parseOneOf(in item) (ast.Node, error) {
 	name := t.nextNonComment()
-	if name.typ != itemIdent {
-		return nil, fmt.Errorf("expected ident, found %s", name)
+	if name.typ != token.IDENT {
+		return nil, t.errorf(name, "expected ident, found %s", name)
 	}
 	msg := ast.OneOf{
-		Name: &ast.Ident{Name: name.val},
-		Body: []ast.Node{},
+		OneOf: t.pos(in),
+		Name:  t.ident(name),
+		Body:  []ast.Node{},
 	}
 
 	lBrace := t.nextNonComment()
-	if lBrace.typ != itemLeftBrace {
-		return nil, fmt.Errorf("expected {, found %s", lBrace)
+	if lBrace.typ != token.LBRACE {
+		return nil, t.errorf(lBrace, "expected {, found %s", lBrace)
 	}
+	msg.Opening = t.pos(lBrace)
+
+	t.depth++
+	defer func() { t.depth-- }()
 
 	for {
+		var node ast.Node
+		var err error
 		switch tok := t.nextNonComment(); {
-		case tok.typ == itemSemiColon:
-			msg.Body = append(msg.Body, &ast.EmptyStmt{Semicolon: token.Pos(0)})
-		case tok.typ == itemMessage:
-			nmsg, err := t.parseMessage()
-			if err != nil {
-				return nil, err
-			}
-			msg.Body = append(msg.Body, nmsg)
-		case tok.typ == itemOption:
-			// Should be constant here, not bool
-			toks, err := t.expect(itemIdent, itemEq, itemBoolLit, itemSemiColon)
-			if err != nil {
-				return nil, err
-			}
-			msg.Body = append(msg.Body, &ast.Option{
-				Names:    []*ast.Ident{{Name: toks[0].val}},
-				Constant: &ast.BasicLit{Kind: token.BOOL, Value: toks[2].val},
-			})
-		case tok.typ == itemRepeated:
-			toks, err := t.expect(itemIdent, itemIdent, itemEq, itemIntLit, itemSemiColon)
-			if err != nil {
-				return nil, err
-			}
-			msg.Body = append(msg.Body, &ast.MessageField{
-				Repeated: &ast.Ident{Name: tok.val},
-				Type:     &ast.Ident{Name: toks[0].val},
-				Name:     &ast.Ident{Name: toks[1].val},
-				Number:   &ast.BasicLit{Kind: token.INT, Value: toks[3].val},
-			})
-		case tok.typ == itemIdent:
-			toks, err := t.expect(itemIdent, itemEq, itemIntLit, itemSemiColon)
-			if err != nil {
-				return nil, err
-			}
-			msg.Body = append(msg.Body, &ast.MessageField{
-				Type:   &ast.Ident{Name: tok.val},
-				Name:   &ast.Ident{Name: toks[0].val},
-				Number: &ast.BasicLit{Kind: token.INT, Value: toks[2].val},
-			})
-		case tok.typ == itemMap:
-			mapt, err := t.expect(itemLeftMap, itemIdent, itemComma, itemIdent, itemRightMap)
-			if err != nil {
-				return nil, err
-			}
-			toks, err := t.expect(itemIdent, itemEq, itemIntLit, itemSemiColon)
-			if err != nil {
-				return nil, err
-			}
-			msg.Body = append(msg.Body, &ast.MessageField{
-				Type: &ast.MapType{
-					Key:   &ast.Ident{Name: mapt[1].val},
-					Value: &ast.Ident{Name: mapt[3].val},
-				},
-				Name:   &ast.Ident{Name: toks[0].val},
-				Number: &ast.BasicLit{Kind: token.INT, Value: toks[2].val},
-			})
-		case tok.typ == itemRightBrace:
+		case tok.typ == token.SEMICOLON:
+			node = &ast.EmptyStmt{Semicolon: t.pos(tok)}
+		case tok.is(token.MESSAGE):
+			node, err = t.parseMessage(tok)
+		case tok.is(token.OPTION):
+			node, err = t.parseOption(tok)
+		case tok.is(token.REPEATED):
+			node, err = t.parseField(t.ident(tok), t.nextNonComment())
+		case tok.typ == token.IDENT || tok.typ == token.PERIOD:
+			node, err = t.parseField(nil, tok)
+		case tok.typ == token.RBRACE:
+			msg.Closing = t.pos(tok)
+			return &msg, nil
+		case tok.typ == token.EOF:
+			t.errorf(tok, "expected }, found %s", tok)
 			return &msg, nil
 		default:
-			return nil, fmt.Errorf("unexpected token in message: %s", tok)
+			err = t.errorf(tok, "unexpected token in oneof: %s", tok)
 		}
+		if err != nil {
+			t.sync()
+			continue
+		}
+		msg.Body = append(msg.Body, node)
 	}
 }
 
-func (t *tree) parseEnum() (ast.Node, error) {
+func (t *tree) parseEnum(in item) (ast.Node, error) {
 	name := t.nextNonComment()
-	if name.typ != itemIdent {
-		return nil, fmt.Errorf("expected ident, found %s", name)
+	if name.typ != token.IDENT {
+		return nil, t.errorf(name, "expected ident, found %s", name)
 	}
 	msg := ast.Enum{
-		Name: &ast.Ident{Name: name.val},
+		Enum: t.pos(in),
+		Name: t.ident(name),
 		Body: []ast.Node{},
 	}
 
 	lBrace := t.nextNonComment()
-	if lBrace.typ != itemLeftBrace {
-		return nil, fmt.Errorf("expected {, found %s", lBrace)
+	if lBrace.typ != token.LBRACE {
+		return nil, t.errorf(lBrace, "expected {, found %s", lBrace)
 	}
+	msg.Opening = t.pos(lBrace)
+
+	t.depth++
+	defer func() { t.depth-- }()
 
 	for {
+		var node ast.Node
+		var err error
 		switch tok := t.nextNonComment(); {
-		case tok.typ == itemSemiColon:
-			msg.Body = append(msg.Body, &ast.EmptyStmt{Semicolon: token.Pos(0)})
-		case tok.typ == itemOption:
-			// Should be constant here, not bool
-			toks, err := t.expect(itemIdent, itemEq, itemBoolLit, itemSemiColon)
-			if err != nil {
-				return nil, err
-			}
-			msg.Body = append(msg.Body, &ast.Option{
-				Names:    []*ast.Ident{{Name: toks[0].val}},
-				Constant: &ast.BasicLit{Kind: token.BOOL, Value: toks[2].val},
-			})
-		case tok.typ == itemIdent:
-			toks, err := t.expect(itemEq, itemIntLit, itemSemiColon)
-			if err != nil {
-				return nil, err
-			}
-			msg.Body = append(msg.Body, &ast.EnumField{
-				Name:  &ast.Ident{Name: tok.val},
-				Value: toks[1].val,
-			})
-		case tok.typ == itemRightBrace:
+		case tok.typ == token.SEMICOLON:
+			node = &ast.EmptyStmt{Semicolon: t.pos(tok)}
+		case tok.is(token.OPTION) && t.peek().typ != token.ASSIGN:
+			node, err = t.parseOption(tok)
+		case tok.is(token.RESERVED) && t.isReservation(t.peek()):
+			node, err = t.parseReserved(tok)
+		case tok.typ == token.IDENT:
+			node, err = t.parseEnumField(tok)
+		case tok.typ == token.RBRACE:
+			msg.Closing = t.pos(tok)
+			return &msg, nil
+		case tok.typ == token.EOF:
+			t.errorf(tok, "expected }, found %s", tok)
 			return &msg, nil
 		default:
-			return nil, fmt.Errorf("unexpected token in enum: %s", tok)
+			err = t.errorf(tok, "unexpected token in enum: %s", tok)
 		}
+		if err != nil {
+			t.sync()
+			continue
+		}
+		msg.Body = append(msg.Body, node)
 	}
 }
 
+// parseEnumField parses an enum value after its name.
+func (t *tree) parseEnumField(name item) (ast.Node, error) {
+	if _, err := t.expect(token.ASSIGN); err != nil {
+		return nil, err
+	}
+	value, err := t.int32Lit(t.nextNonComment())
+	if err != nil {
+		return nil, err
+	}
+	field := ast.EnumField{
+		Name:     t.ident(name),
+		ValuePos: value.ValuePos,
+		Value:    value.Decoded,
+	}
+	end := t.nextNonComment()
+	if end.typ == token.LBRACK {
+		if field.Options, err = t.parseCompactOptions(); err != nil {
+			return nil, err
+		}
+		end = t.nextNonComment()
+	}
+	if end.typ != token.SEMICOLON {
+		return nil, t.errorf(end, "unexpected token: %s", end)
+	}
+	field.Semicolon = t.pos(end)
+	return &field, nil
+}
+
 func (t *tree) parseService(in item) (ast.Node, error) {
 	name := t.nextNonComment()
-	if name.typ != itemIdent {
-		return nil, fmt.Errorf("expected ident, found %s", name)
+	if name.typ != token.IDENT {
+		return nil, t.errorf(name, "expected ident, found %s", name)
 	}
 
 	srv := ast.Service{
-		Service: token.Pos(in.pos),
-		Name:    &ast.Ident{NamePos: token.Pos(name.pos), Name: name.val},
+		Service: t.pos(in),
+		Name:    t.ident(name),
 	}
 
 	lBrace := t.nextNonComment()
-	if lBrace.typ != itemLeftBrace {
-		return nil, fmt.Errorf("expected {, found %s", lBrace)
+	if lBrace.typ != token.LBRACE {
+		return nil, t.errorf(lBrace, "expected {, found %s", lBrace)
 	}
 
 	blk := ast.BlockStmt{
-		Opening: token.Pos(lBrace.pos),
+		Opening: t.pos(lBrace),
 		List:    []ast.Node{},
 	}
 
+	t.depth++
+	defer func() { t.depth-- }()
+
+	for {
+		var node ast.Node
+		var err error
+		switch tok := t.nextNonComment(); {
+		case tok.typ == token.SEMICOLON:
+			node = &ast.EmptyStmt{Semicolon: t.pos(tok)}
+		case tok.is(token.OPTION):
+			node, err = t.parseOption(tok)
+		case tok.is(token.RPC):
+			node, err = t.parseRPC(tok)
+		case tok.typ == token.RBRACE:
+			blk.Closing = t.pos(tok)
+			srv.Body = &blk
+			return &srv, nil
+		case tok.typ == token.EOF:
+			t.errorf(tok, "expected }, found %s", tok)
+			srv.Body = &blk
+			return &srv, nil
+		default:
+			err = t.errorf(tok, "unexpected token in service: %s", tok)
+		}
+		if err != nil {
+			t.sync()
+			continue
+		}
+		blk.List = append(blk.List, node)
+	}
+}
+
+// parseRPC parses an rpc method after the rpc keyword. The method either
+// ends with a semicolon or with a body of options in braces.
+func (t *tree) parseRPC(in item) (ast.Node, error) {
+	toks, err := t.expect(token.IDENT)
+	if err != nil {
+		return nil, err
+	}
+	rpc := ast.RPC{
+		RPC:  t.pos(in),
+		Name: t.ident(toks[0]),
+	}
+
+	if rpc.InType, rpc.ClientStreaming, err = t.parseRPCType(); err != nil {
+		return nil, err
+	}
+	if _, err := t.expect(token.RETURNS); err != nil {
+		return nil, err
+	}
+	if rpc.OutType, rpc.ServerStreaming, err = t.parseRPCType(); err != nil {
+		return nil, err
+	}
+
+	switch tok := t.nextNonComment(); tok.typ {
+	case token.SEMICOLON:
+		rpc.Closing = t.pos(tok)
+		return &rpc, nil
+	case token.LBRACE:
+	default:
+		return nil, t.errorf(tok, "unexpected token: %s", tok)
+	}
+
+	t.depth++
+	defer func() { t.depth-- }()
+
 	for {
 		switch tok := t.nextNonComment(); {
-		case tok.typ == itemSemiColon:
-			blk.List = append(blk.List, &ast.EmptyStmt{Semicolon: token.Pos(0)})
-		case tok.typ == itemOption:
-			// Should be constant here, not bool
-			toks, err := t.expect(itemIdent, itemEq, itemBoolLit, itemSemiColon)
+		case tok.typ == token.SEMICOLON:
+			// No action
+		case tok.is(token.OPTION):
+			opt, err := t.parseOption(tok)
 			if err != nil {
-				return nil, err
+				t.sync()
+				continue
 			}
-			blk.List = append(blk.List, &ast.Option{
-				Names:    []*ast.Ident{{Name: toks[0].val}},
-				Constant: &ast.BasicLit{Kind: token.BOOL, Value: toks[2].val},
-			})
-		case tok.typ == itemRPC:
-			toks, err := t.expect(itemIdent, itemLeftParen, itemIdent, itemRightParen,
-				itemReturns, itemLeftParen, itemIdent, itemRightParen,
-				itemLeftBrace, itemRightBrace)
-			if err != nil {
-				return nil, err
-			}
-			blk.List = append(blk.List, &ast.RPC{
-				RPC:     token.Pos(tok.pos),
-				Name:    &ast.Ident{Name: toks[0].val, NamePos: token.Pos(toks[0].pos)},
-				InType:  &ast.Ident{Name: toks[2].val, NamePos: token.Pos(toks[2].pos)},
-				OutType: &ast.Ident{Name: toks[6].val, NamePos: token.Pos(toks[6].pos)},
-			})
-		case tok.typ == itemRightBrace:
-			blk.Closing = token.Pos(tok.pos)
-			srv.Body = &blk
-			return &srv, nil
+			rpc.Options = append(rpc.Options, opt)
+		case tok.typ == token.RBRACE:
+			rpc.Closing = t.pos(tok)
+			return &rpc, nil
+		case tok.typ == token.EOF:
+			t.errorf(tok, "expected }, found %s", tok)
+			return &rpc, nil
 		default:
-			return nil, fmt.Errorf("unexpected token in enum: %s", tok)
+			t.errorf(tok, "unexpected token in rpc: %s", tok)
+			t.sync()
 		}
 	}
 }
 
-// nextNonSpace returns the next non-space token.
-func (t *tree) nextNonComment() (token item) {
+// parseRPCType parses a parenthesized rpc input or output type, which may
+// be preceded by the stream keyword.
+func (t *tree) parseRPCType() (ast.Node, bool, error) {
+	if _, err := t.expect(token.LPAREN); err != nil {
+		return nil, false, err
+	}
+	tok := t.nextNonComment()
+	stream := false
+	if next := t.peek(); tok.is(token.STREAM) && (next.typ == token.IDENT || next.typ == token.PERIOD) {
+		stream = true
+		tok = t.nextNonComment()
+	}
+	typ, err := t.parseTypeName(tok)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := t.expect(token.RPAREN); err != nil {
+		return nil, false, err
+	}
+	return typ, stream, nil
+}
+
+// nextNonComment returns the next non-comment token.
+func (t *tree) nextNonComment() (tok item) {
+	if t.peekCount > 0 {
+		t.peekCount--
+		return t.token[0]
+	}
+	var comments []item
 	for {
-		token = t.l.nextItem()
-		if token.typ != itemComment {
+		tok = t.l.nextItem()
+		if tok.typ != token.COMMENT {
 			break
 		}
+		comments = append(comments, tok)
 	}
-	return token
+	if t.comments != nil && len(comments) > 0 {
+		t.groupComments(comments, tok)
+	}
+	t.token[0] = tok
+	return tok
+}
+
+// backup backs the input stream up one token.
+func (t *tree) backup() {
+	t.peekCount++
+}
+
+// peek returns but does not consume the next non-comment token.
+func (t *tree) peek() item {
+	tok := t.nextNonComment()
+	t.backup()
+	return tok
 }
@@ -0,0 +1,342 @@
+// Package scanner implements a scanner for protocol buffer source text.
+// It takes a []byte as source which can then be tokenized through repeated
+// calls to the Scan method.
+package scanner
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kyleconroy/pb/token"
+)
+
+// An ErrorHandler may be provided to Scanner.Init. If a syntax error is
+// encountered and a handler was installed, the handler is called with a
+// position and an error message. The position points to the beginning of
+// the offending token.
+type ErrorHandler func(pos token.Position, msg string)
+
+// A Mode value is a set of flags (or 0). They control scanner behavior.
+type Mode uint
+
+const (
+	ScanComments Mode = 1 << iota // return comments as COMMENT tokens
+)
+
+const eof = -1
+
+// A Scanner holds the scanner's internal state while processing a given
+// text. It can be allocated as part of another data structure but must be
+// initialized via Init before use.
+type Scanner struct {
+	// immutable state
+	file *token.File  // source file handle
+	src  []byte       // source
+	err  ErrorHandler // error reporting; or nil
+	mode Mode         // scanning mode
+
+	// scanning state
+	ch       rune // current character
+	offset   int  // character offset
+	rdOffset int  // reading offset (position after current character)
+
+	// public state - ok to modify
+	ErrorCount int // number of errors encountered
+}
+
+// Init prepares the scanner s to tokenize the text src by setting the
+// scanner at the beginning of src. The scanner uses the file set file
+// for position information and it adds line information for each line.
+// It is ok to re-use the same file when re-scanning the same file as
+// line information which is already present is ignored. Init causes a
+// panic if the file size does not match the src size.
+//
+// Calls to Scan will invoke the error handler err if they encounter a
+// syntax error and err is not nil. Also, for each error encountered,
+// the Scanner field ErrorCount is incremented by one.
+func (s *Scanner) Init(file *token.File, src []byte, err ErrorHandler, mode Mode) {
+	if file.Size() != len(src) {
+		panic(fmt.Sprintf("file size (%d) does not match src len (%d)", file.Size(), len(src)))
+	}
+	s.file = file
+	s.src = src
+	s.err = err
+	s.mode = mode
+
+	s.ch = ' '
+	s.offset = 0
+	s.rdOffset = 0
+	s.ErrorCount = 0
+
+	s.next()
+}
+
+// next reads the next Unicode character into s.ch.
+// s.ch < 0 means end-of-file.
+func (s *Scanner) next() {
+	if s.rdOffset < len(s.src) {
+		s.offset = s.rdOffset
+		if s.ch == '\n' {
+			s.file.AddLine(s.offset)
+		}
+		r, w := rune(s.src[s.rdOffset]), 1
+		if r >= utf8.RuneSelf {
+			r, w = utf8.DecodeRune(s.src[s.rdOffset:])
+			if r == utf8.RuneError && w == 1 {
+				s.error(s.offset, "illegal UTF-8 encoding")
+			}
+		}
+		s.rdOffset += w
+		s.ch = r
+	} else {
+		s.offset = len(s.src)
+		if s.ch == '\n' {
+			s.file.AddLine(s.offset)
+		}
+		s.ch = eof
+	}
+}
+
+// peek returns the byte following the most recently read character without
+// advancing the scanner. If the scanner is at EOF, peek returns 0.
+func (s *Scanner) peek() byte {
+	if s.rdOffset < len(s.src) {
+		return s.src[s.rdOffset]
+	}
+	return 0
+}
+
+func (s *Scanner) error(offs int, msg string) {
+	if s.err != nil {
+		s.err(s.file.Position(s.file.Pos(offs)), msg)
+	}
+	s.ErrorCount++
+}
+
+func (s *Scanner) errorf(offs int, format string, args ...interface{}) {
+	s.error(offs, fmt.Sprintf(format, args...))
+}
+
+// accept consumes the current character if it's from the valid set.
+func (s *Scanner) accept(valid string) bool {
+	if s.ch >= 0 && strings.ContainsRune(valid, s.ch) {
+		s.next()
+		return true
+	}
+	return false
+}
+
+// acceptRun consumes a run of characters from the valid set and reports
+// whether any were consumed.
+func (s *Scanner) acceptRun(valid string) bool {
+	offs := s.offset
+	for s.accept(valid) {
+	}
+	return s.offset > offs
+}
+
+func (s *Scanner) skipWhitespace() {
+	for s.ch == ' ' || s.ch == '\t' || s.ch == '\n' || s.ch == '\r' || s.ch == '\f' || s.ch == '\v' {
+		s.next()
+	}
+}
+
+// scanComment scans a line or block comment; the initial '/' has already
+// been consumed. The text of a line comment excludes the trailing newline.
+func (s *Scanner) scanComment() string {
+	offs := s.offset - 1 // position of initial '/'
+
+	if s.ch == '/' {
+		//-style comment
+		for s.ch != '\n' && s.ch >= 0 {
+			s.next()
+		}
+		lit := s.src[offs:s.offset]
+		if n := len(lit); n > 0 && lit[n-1] == '\r' {
+			lit = lit[:n-1]
+		}
+		return string(lit)
+	}
+
+	/*-style comment */
+	s.next()
+	for s.ch >= 0 {
+		ch := s.ch
+		s.next()
+		if ch == '*' && s.ch == '/' {
+			s.next()
+			return string(s.src[offs:s.offset])
+		}
+	}
+	s.error(offs, "unterminated block comment")
+	return string(s.src[offs:s.offset])
+}
+
+func (s *Scanner) scanIdentifier() string {
+	offs := s.offset
+	for isLetter(s.ch) || isDigit(s.ch) {
+		s.next()
+	}
+	return string(s.src[offs:s.offset])
+}
+
+// scanNumber scans an integer or floating point literal. Integers may be
+// decimal, octal (017) or hexadecimal (0x1F). Signs are separate tokens,
+// and the special float values inf and nan are identifiers.
+func (s *Scanner) scanNumber() (token.Token, string) {
+	const digits = "0123456789"
+	offs := s.offset
+	tok := token.INT
+	if s.accept("0") && s.accept("xX") {
+		if !s.acceptRun("0123456789abcdefABCDEF") {
+			s.errorf(offs, "bad number syntax: %q", s.src[offs:s.offset])
+		}
+	} else {
+		s.acceptRun(digits)
+		if s.accept(".") {
+			tok = token.FLOAT
+			s.acceptRun(digits)
+		}
+		if !strings.ContainsAny(string(s.src[offs:s.offset]), digits) {
+			s.errorf(offs, "bad number syntax: %q", s.src[offs:s.offset])
+			return token.ILLEGAL, string(s.src[offs:s.offset])
+		}
+		if s.accept("eE") {
+			tok = token.FLOAT
+			s.accept("+-")
+			if !s.acceptRun(digits) {
+				s.errorf(offs, "bad number syntax: %q", s.src[offs:s.offset])
+			}
+		}
+		num := s.src[offs:s.offset]
+		if tok == token.INT && len(num) > 1 && num[0] == '0' && strings.ContainsAny(string(num), "89") {
+			s.errorf(offs, "invalid octal number: %q", s.src[offs:s.offset])
+		}
+	}
+	if isLetter(s.ch) || isDigit(s.ch) {
+		s.scanIdentifier()
+		s.errorf(offs, "bad number syntax: %q", s.src[offs:s.offset])
+	}
+	return tok, string(s.src[offs:s.offset])
+}
+
+// scanString scans a single or double quoted string; the opening quote has
+// already been consumed. Escape sequences are checked when the literal is
+// decoded.
+func (s *Scanner) scanString(quote rune) string {
+	offs := s.offset - 1 // position of opening quote
+
+	for {
+		ch := s.ch
+		if ch == '\n' || ch < 0 {
+			s.error(offs, "unterminated quoted string")
+			break
+		}
+		s.next()
+		if ch == quote {
+			break
+		}
+		if ch == '\\' && s.ch != '\n' && s.ch >= 0 {
+			s.next()
+		}
+	}
+	return string(s.src[offs:s.offset])
+}
+
+// Scan scans the next token and returns the token position, the token,
+// and its literal string if applicable. The source end is indicated by
+// token.EOF.
+//
+// If the returned token is a literal (token.IDENT, token.INT, token.FLOAT,
+// token.STRING) or token.COMMENT, the literal string has the corresponding
+// value. Identifiers are returned as token.IDENT, including keywords and
+// the values true and false; the parser decides their meaning from context.
+//
+// If the returned token is token.ILLEGAL, the literal string is the
+// offending character or number.
+//
+// In all other cases, Scan returns an empty literal string.
+//
+// Comments are skipped unless the ScanComments mode is set.
+func (s *Scanner) Scan() (pos token.Pos, tok token.Token, lit string) {
+scanAgain:
+	s.skipWhitespace()
+
+	// current token start
+	pos = s.file.Pos(s.offset)
+
+	// determine token value
+	switch ch := s.ch; {
+	case isLetter(ch):
+		lit = s.scanIdentifier()
+		tok = token.IDENT
+	case isDigit(ch) || (ch == '.' && isDigit(rune(s.peek()))):
+		tok, lit = s.scanNumber()
+	default:
+		s.next() // always make progress
+		switch ch {
+		case eof:
+			tok = token.EOF
+		case '"', '\'':
+			tok = token.STRING
+			lit = s.scanString(ch)
+		case '/':
+			if s.ch != '/' && s.ch != '*' {
+				tok = token.QUO
+				break
+			}
+			comment := s.scanComment()
+			if s.mode&ScanComments == 0 {
+				goto scanAgain
+			}
+			tok = token.COMMENT
+			lit = comment
+		case '.':
+			tok = token.PERIOD
+		case ',':
+			tok = token.COMMA
+		case ':':
+			tok = token.COLON
+		case ';':
+			tok = token.SEMICOLON
+		case '=':
+			tok = token.ASSIGN
+		case '<':
+			tok = token.LSS
+		case '>':
+			tok = token.GTR
+		case '(':
+			tok = token.LPAREN
+		case ')':
+			tok = token.RPAREN
+		case '[':
+			tok = token.LBRACK
+		case ']':
+			tok = token.RBRACK
+		case '{':
+			tok = token.LBRACE
+		case '}':
+			tok = token.RBRACE
+		case '+':
+			tok = token.ADD
+		case '-':
+			tok = token.SUB
+		default:
+			s.errorf(s.file.Offset(pos), "illegal character %#U", ch)
+			tok = token.ILLEGAL
+			lit = string(ch)
+		}
+	}
+	return
+}
+
+// isLetter and isDigit only accept ASCII, as the language spec does; other
+// characters are reported as illegal.
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+}
+
+func isDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9'
+}
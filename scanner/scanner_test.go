@@ -0,0 +1,174 @@
+package scanner
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/kyleconroy/pb/token"
+)
+
+type elt struct {
+	tok token.Token
+	lit string
+}
+
+const source = `syntax = "proto3";
+// comment
+message Foo {
+  map<string, int32> bar = 1 [(a.b) = -inf];
+  /* block
+     comment */
+  double baz = 0x1F; float qux = .5e-3;
+}
+`
+
+var tokens = []elt{
+	{token.IDENT, "syntax"},
+	{token.ASSIGN, ""},
+	{token.STRING, `"proto3"`},
+	{token.SEMICOLON, ""},
+	{token.COMMENT, "// comment"},
+	{token.IDENT, "message"},
+	{token.IDENT, "Foo"},
+	{token.LBRACE, ""},
+	{token.IDENT, "map"},
+	{token.LSS, ""},
+	{token.IDENT, "string"},
+	{token.COMMA, ""},
+	{token.IDENT, "int32"},
+	{token.GTR, ""},
+	{token.IDENT, "bar"},
+	{token.ASSIGN, ""},
+	{token.INT, "1"},
+	{token.LBRACK, ""},
+	{token.LPAREN, ""},
+	{token.IDENT, "a"},
+	{token.PERIOD, ""},
+	{token.IDENT, "b"},
+	{token.RPAREN, ""},
+	{token.ASSIGN, ""},
+	{token.SUB, ""},
+	{token.IDENT, "inf"},
+	{token.RBRACK, ""},
+	{token.SEMICOLON, ""},
+	{token.COMMENT, "/* block\n     comment */"},
+	{token.IDENT, "double"},
+	{token.IDENT, "baz"},
+	{token.ASSIGN, ""},
+	{token.INT, "0x1F"},
+	{token.SEMICOLON, ""},
+	{token.IDENT, "float"},
+	{token.IDENT, "qux"},
+	{token.ASSIGN, ""},
+	{token.FLOAT, ".5e-3"},
+	{token.SEMICOLON, ""},
+	{token.RBRACE, ""},
+	{token.EOF, ""},
+}
+
+func TestScan(t *testing.T) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("source.proto", -1, len(source))
+
+	var s Scanner
+	s.Init(file, []byte(source), func(pos token.Position, msg string) {
+		t.Errorf("%s: %s", pos, msg)
+	}, ScanComments)
+	for i, e := range tokens {
+		_, tok, lit := s.Scan()
+		if tok != e.tok || lit != e.lit {
+			t.Errorf("token %d: expected %s %q, got %s %q", i, e.tok, e.lit, tok, lit)
+		}
+	}
+
+	// Positions are available once a line has been scanned
+	if pos := fset.Position(file.Pos(len(source) - 2)); pos.String() != "source.proto:8:1" {
+		t.Errorf("expected source.proto:8:1, got %s", pos)
+	}
+}
+
+func TestScanSkipsComments(t *testing.T) {
+	src := "// a\nfoo /* b */ bar"
+	fset := token.NewFileSet()
+	var s Scanner
+	s.Init(fset.AddFile("", -1, len(src)), []byte(src), nil, 0)
+	for _, expected := range []string{"foo", "bar", ""} {
+		if _, _, lit := s.Scan(); lit != expected {
+			t.Errorf("expected %q, got %q", expected, lit)
+		}
+	}
+}
+
+func TestScanWhitespace(t *testing.T) {
+	src := "foo\f\vbar\r\n\tbaz"
+	fset := token.NewFileSet()
+	var s Scanner
+	s.Init(fset.AddFile("", -1, len(src)), []byte(src), func(pos token.Position, msg string) {
+		t.Errorf("%s: %s", pos, msg)
+	}, 0)
+	for _, expected := range []string{"foo", "bar", "baz", ""} {
+		if _, _, lit := s.Scan(); lit != expected {
+			t.Errorf("expected %q, got %q", expected, lit)
+		}
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src string
+		pos string
+	}{
+		{`09`, "1:1"},
+		{`0x`, "1:1"},
+		{`1e`, "1:1"},
+		{`12abc`, "1:1"},
+		{`"foo`, "1:1"},
+		{"'foo\n'", "1:1"},
+		{`a /* b`, "1:3"},
+		{`a $`, "1:3"},
+		{`a ٣`, "1:3"},
+		{`a é`, "1:3"},
+	} {
+		fset := token.NewFileSet()
+		var s Scanner
+		var pos string
+		s.Init(fset.AddFile("", -1, len(tc.src)), []byte(tc.src), func(p token.Position, msg string) {
+			if pos == "" {
+				pos = p.String()
+			}
+		}, 0)
+		for _, tok, _ := s.Scan(); tok != token.EOF; _, tok, _ = s.Scan() {
+		}
+		if s.ErrorCount == 0 {
+			t.Errorf("expected an error for %s", tc.src)
+		} else if pos != tc.pos {
+			t.Errorf("%s: expected error at %s, got %s", tc.src, tc.pos, pos)
+		}
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	files, _ := filepath.Glob(filepath.Join("..", "wellknown", "google", "protobuf", "*.proto"))
+	srcs := make([][]byte, len(files))
+	size := 0
+	for i, name := range files {
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		srcs[i] = src
+		size += len(src)
+	}
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, src := range srcs {
+			fset := token.NewFileSet()
+			var s Scanner
+			s.Init(fset.AddFile("", -1, len(src)), src, nil, ScanComments)
+			for _, tok, _ := s.Scan(); tok != token.EOF; _, tok, _ = s.Scan() {
+			}
+		}
+	}
+}
@@ -1,11 +1,178 @@
+// Package token defines constants representing the lexical tokens of the
+// protocol buffer language and basic operations on tokens (printing,
+// predicates).
 package token
 
+import "strconv"
+
+// Token is the set of lexical tokens of the protocol buffer language.
 type Token int
 
+// The list of tokens.
 const (
 	// Special tokens
 	ILLEGAL Token = iota
-	INT           // 12345
-	STRING        // "abc"
-	BOOL          // true | false
+	EOF
+	COMMENT
+
+	literal_beg
+	// Identifiers and basic type literals
+	// (these tokens stand for classes of literals)
+	IDENT  // main
+	INT    // 12345, 0x1F, 017
+	FLOAT  // 123.45, 1e10, inf
+	STRING // "abc"
+	BOOL   // true | false
+	literal_end
+
+	operator_beg
+	// Punctuation
+	PERIOD    // .
+	COMMA     // ,
+	COLON     // :
+	SEMICOLON // ;
+	ASSIGN    // =
+	LSS       // <
+	GTR       // >
+	LPAREN    // (
+	RPAREN    // )
+	LBRACK    // [
+	RBRACK    // ]
+	LBRACE    // {
+	RBRACE    // }
+	QUO       // /
+	ADD       // +
+	SUB       // -
+	operator_end
+
+	keyword_beg
+	// Keywords
+	EDITION
+	ENUM
+	EXTEND
+	EXTENSIONS
+	GROUP
+	IMPORT
+	MAP
+	MAX
+	MESSAGE
+	ONEOF
+	OPTION
+	OPTIONAL
+	PACKAGE
+	PUBLIC
+	REPEATED
+	REQUIRED
+	RESERVED
+	RETURNS
+	RPC
+	SERVICE
+	STREAM
+	SYNTAX
+	TO
+	WEAK
+	keyword_end
 )
+
+var tokens = [...]string{
+	ILLEGAL: "ILLEGAL",
+
+	EOF:     "EOF",
+	COMMENT: "COMMENT",
+
+	IDENT:  "IDENT",
+	INT:    "INT",
+	FLOAT:  "FLOAT",
+	STRING: "STRING",
+	BOOL:   "BOOL",
+
+	PERIOD:    ".",
+	COMMA:     ",",
+	COLON:     ":",
+	SEMICOLON: ";",
+	ASSIGN:    "=",
+	LSS:       "<",
+	GTR:       ">",
+	LPAREN:    "(",
+	RPAREN:    ")",
+	LBRACK:    "[",
+	RBRACK:    "]",
+	LBRACE:    "{",
+	RBRACE:    "}",
+	QUO:       "/",
+	ADD:       "+",
+	SUB:       "-",
+
+	EDITION:    "edition",
+	ENUM:       "enum",
+	EXTEND:     "extend",
+	EXTENSIONS: "extensions",
+	GROUP:      "group",
+	IMPORT:     "import",
+	MAP:        "map",
+	MAX:        "max",
+	MESSAGE:    "message",
+	ONEOF:      "oneof",
+	OPTION:     "option",
+	OPTIONAL:   "optional",
+	PACKAGE:    "package",
+	PUBLIC:     "public",
+	REPEATED:   "repeated",
+	REQUIRED:   "required",
+	RESERVED:   "reserved",
+	RETURNS:    "returns",
+	RPC:        "rpc",
+	SERVICE:    "service",
+	STREAM:     "stream",
+	SYNTAX:     "syntax",
+	TO:         "to",
+	WEAK:       "weak",
+}
+
+// String returns the string corresponding to the token tok.
+// For operators and keywords, the string is the actual
+// token character sequence (e.g., for the token SEMICOLON,
+// the string is ";"). For all other tokens the string
+// corresponds to the token constant name (e.g. for the
+// token IDENT, the string is "IDENT").
+func (tok Token) String() string {
+	s := ""
+	if 0 <= tok && tok < Token(len(tokens)) {
+		s = tokens[tok]
+	}
+	if s == "" {
+		s = "token(" + strconv.Itoa(int(tok)) + ")"
+	}
+	return s
+}
+
+var keywords map[string]Token
+
+func init() {
+	keywords = make(map[string]Token)
+	for i := keyword_beg + 1; i < keyword_end; i++ {
+		keywords[tokens[i]] = i
+	}
+}
+
+// Lookup maps an identifier to its keyword token or IDENT (if not a
+// keyword). Keywords in proto files are contextual: a keyword may still
+// be used as a name wherever an identifier is expected.
+func Lookup(ident string) Token {
+	if tok, isKeyword := keywords[ident]; isKeyword {
+		return tok
+	}
+	return IDENT
+}
+
+// IsLiteral returns true for tokens corresponding to identifiers
+// and basic type literals; it returns false otherwise.
+func (tok Token) IsLiteral() bool { return literal_beg < tok && tok < literal_end }
+
+// IsOperator returns true for tokens corresponding to punctuation;
+// it returns false otherwise.
+func (tok Token) IsOperator() bool { return operator_beg < tok && tok < operator_end }
+
+// IsKeyword returns true for tokens corresponding to keywords;
+// it returns false otherwise.
+func (tok Token) IsKeyword() bool { return keyword_beg < tok && tok < keyword_end }
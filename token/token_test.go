@@ -0,0 +1,63 @@
+package token
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	for _, tc := range []struct {
+		ident string
+		tok   Token
+	}{
+		{"message", MESSAGE},
+		{"extensions", EXTENSIONS},
+		{"stream", STREAM},
+		{"max", MAX},
+		{"Message", IDENT},
+		{"int32", IDENT},
+		{"true", IDENT},
+	} {
+		if tok := Lookup(tc.ident); tok != tc.tok {
+			t.Errorf("Lookup(%q): expected %s, got %s", tc.ident, tc.tok, tok)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	for tok := ILLEGAL; tok < keyword_end; tok++ {
+		if tok == literal_beg || tok == literal_end || tok == operator_beg || tok == operator_end || tok == keyword_beg {
+			continue
+		}
+		if s := tok.String(); strings.HasPrefix(s, "token(") {
+			t.Errorf("token %d has no string", tok)
+		}
+		if tok.IsKeyword() && Lookup(tok.String()) != tok {
+			t.Errorf("keyword %s does not round trip through Lookup", tok)
+		}
+	}
+	if s := Token(-1).String(); s != "token(-1)" {
+		t.Errorf("expected token(-1), got %s", s)
+	}
+}
+
+func TestPredicates(t *testing.T) {
+	for _, tc := range []struct {
+		tok                        Token
+		literal, operator, keyword bool
+	}{
+		{ILLEGAL, false, false, false},
+		{COMMENT, false, false, false},
+		{IDENT, true, false, false},
+		{STRING, true, false, false},
+		{BOOL, true, false, false},
+		{SEMICOLON, false, true, false},
+		{RBRACE, false, true, false},
+		{EDITION, false, false, true},
+		{WEAK, false, false, true},
+	} {
+		if tc.tok.IsLiteral() != tc.literal || tc.tok.IsOperator() != tc.operator || tc.tok.IsKeyword() != tc.keyword {
+			t.Errorf("unexpected classification of %s", tc.tok)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package types
+
+import (
+	"math"
+
+	"github.com/kyleconroy/pb/ast"
+)
+
+// allowAlias returns the allow_alias option of an enum, or nil if the enum
+// doesn't allow aliases.
+func allowAlias(enum *ast.Enum) *ast.Option {
+	for _, node := range enum.Body {
+		opt, ok := node.(*ast.Option)
+		if !ok || len(opt.Names) != 1 || opt.Names[0].Extension {
+			continue
+		}
+		name, ok := opt.Names[0].Name.(*ast.Ident)
+		if !ok || name.Name != "allow_alias" {
+			continue
+		}
+		if lit, ok := opt.Constant.(*ast.BasicLit); ok && lit.Value == "true" {
+			return opt
+		}
+	}
+	return nil
+}
+
+// checkEnum reports enum values that are out of range, reserved, or share a
+// number without allow_alias. In proto3 the first value must be zero.
+func (c *checker) checkEnum(f *ast.File, enum *ast.Enum) {
+	alias := allowAlias(enum)
+	reserved := reservedRanges(enum.Body, math.MaxInt32)
+	reservedNames := map[string]ast.Node{}
+	for _, node := range enum.Body {
+		if res, ok := node.(*ast.Reserved); ok {
+			for _, name := range res.Names {
+				switch name := name.(type) {
+				case *ast.BasicLit:
+					reservedNames[name.Decoded] = name
+				case *ast.Ident:
+					reservedNames[name.Name] = name
+				}
+			}
+		}
+	}
+
+	first := true
+	aliased := false
+	seen := map[int64]*ast.EnumField{}
+	for _, node := range enum.Body {
+		v, ok := node.(*ast.EnumField)
+		if !ok || v.Name == nil {
+			continue
+		}
+		num, ok := intValue(v.Value)
+		if !ok || num < math.MinInt32 || num > math.MaxInt32 {
+			c.errorf(v.ValuePos, "value %s of %s out of range for int32", v.Value, v.Name.Name)
+			continue
+		}
+		if first && f.Syntax == ast.Proto3 && num != 0 {
+			c.errorf(v.ValuePos, "first value of enum %s must be zero in proto3", enum.Name.Name)
+		}
+		first = false
+
+		if prev, ok := seen[num]; ok {
+			aliased = true
+			if alias == nil {
+				c.errorf(v.ValuePos, "value %d of %s already used by %s at %s (set option allow_alias = true to allow aliases)", num, v.Name.Name, prev.Name.Name, c.fset.Position(prev.ValuePos))
+			}
+		} else {
+			seen[num] = v
+		}
+		for _, r := range reserved {
+			if r.low <= num && num <= r.high {
+				c.errorf(v.ValuePos, "value %d of %s is reserved at %s", num, v.Name.Name, c.fset.Position(r.node.Pos()))
+				break
+			}
+		}
+		if res, ok := reservedNames[v.Name.Name]; ok {
+			c.errorf(v.Name.Pos(), "name %s is reserved at %s", v.Name.Name, c.fset.Position(res.Pos()))
+		}
+	}
+
+	if first {
+		c.errorf(enum.Name.Pos(), "enum %s must contain at least one value", enum.Name.Name)
+	}
+	if alias != nil && !aliased {
+		c.errorf(alias.Pos(), "enum %s sets allow_alias, but no values share a number", enum.Name.Name)
+	}
+}
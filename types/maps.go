@@ -0,0 +1,46 @@
+package types
+
+import (
+	"github.com/kyleconroy/pb/ast"
+)
+
+// mapKeys are the scalar types allowed as map keys: every integral type,
+// bool and string.
+var mapKeys = map[string]bool{
+	"int32":    true,
+	"int64":    true,
+	"uint32":   true,
+	"uint64":   true,
+	"sint32":   true,
+	"sint64":   true,
+	"fixed32":  true,
+	"fixed64":  true,
+	"sfixed32": true,
+	"sfixed64": true,
+	"bool":     true,
+	"string":   true,
+}
+
+// checkMap reports a map field with an invalid key type or a label. Errors
+// are reported at the map keyword.
+func (c *checker) checkMap(field *ast.MessageField, m *ast.MapType) {
+	if m.Key != nil && !mapKeys[m.Key.Name] {
+		c.errorf(m.Map, "invalid key type %s of map field %s; keys must be integral, bool or string", m.Key.Name, field.Name.Name)
+	}
+	if field.Label != nil {
+		c.errorf(m.Map, "map field %s cannot be %s", field.Name.Name, field.Label.Name)
+	}
+}
+
+// checkOneOfMaps reports map fields declared in a oneof.
+func (c *checker) checkOneOfMaps(oneof *ast.OneOf) {
+	for _, node := range oneof.Body {
+		field, ok := node.(*ast.MessageField)
+		if !ok {
+			continue
+		}
+		if m, ok := field.Type.(*ast.MapType); ok {
+			c.errorf(m.Map, "map field %s cannot be in a oneof", field.Name.Name)
+		}
+	}
+}
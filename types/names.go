@@ -0,0 +1,97 @@
+package types
+
+import (
+	"strings"
+
+	"github.com/kyleconroy/pb/ast"
+	"github.com/kyleconroy/pb/importer"
+	"github.com/kyleconroy/pb/token"
+)
+
+// A symbol is a name declared in a scope. Every declaration in a set of
+// files, from packages down to fields, shares a single name space keyed by
+// full name, like the descriptor pool of protoc.
+type symbol struct {
+	kind string // e.g. message, field or enum value
+	pos  token.Pos
+}
+
+// define declares a symbol of the given kind, reporting an error if the
+// name is already declared in scope.
+func (c *checker) define(scope, kind string, name *ast.Ident) {
+	if name == nil {
+		return
+	}
+	fullName := join(scope, name.Name)
+	prev, ok := c.names[fullName]
+	switch {
+	case !ok:
+		c.names[fullName] = symbol{kind, name.Pos()}
+	case prev.kind == "package" && kind == "package":
+		// Packages may be declared by any number of files
+	case kind == "enum value":
+		c.errorf(name.Pos(), "enum value %s already declared at %s (enum values are siblings of their enum, not children of it)", fullName, c.fset.Position(prev.pos))
+	default:
+		c.errorf(name.Pos(), "%s %s already declared at %s", kind, fullName, c.fset.Position(prev.pos))
+	}
+}
+
+// defineNames declares every name in file f.
+func (c *checker) defineNames(f *importer.File) {
+	pkg := f.AST.Package()
+	if pkg != nil && pkg.Name != nil {
+		var parts []*ast.Ident
+		switch n := pkg.Name.(type) {
+		case *ast.Ident:
+			parts = []*ast.Ident{n}
+		case *ast.FullIdent:
+			parts = n.Parts
+		}
+		scope := ""
+		for _, p := range parts {
+			c.define(scope, "package", p)
+			scope = join(scope, p.Name)
+		}
+	}
+	c.defineBody(f.AST.PackageName(), f.AST.Nodes)
+}
+
+// defineBody declares the names in body, which belongs to scope.
+func (c *checker) defineBody(scope string, body []ast.Node) {
+	for _, node := range body {
+		switch n := node.(type) {
+		case *ast.Message:
+			c.define(scope, "message", n.Name)
+			c.defineBody(join(scope, n.Name.Name), n.Body)
+		case *ast.Group:
+			// A group declares both a message and a field named after it
+			c.define(scope, "message", n.Name)
+			c.define(scope, "field", &ast.Ident{NamePos: n.Name.NamePos, Name: strings.ToLower(n.Name.Name)})
+			c.defineBody(join(scope, n.Name.Name), n.Body)
+		case *ast.MessageField:
+			c.define(scope, "field", n.Name)
+		case *ast.OneOf:
+			c.define(scope, "oneof", n.Name)
+			c.defineBody(scope, n.Body)
+		case *ast.Extend:
+			c.defineBody(scope, n.Body)
+		case *ast.Enum:
+			c.define(scope, "enum", n.Name)
+			for _, m := range n.Body {
+				if v, ok := m.(*ast.EnumField); ok {
+					c.define(scope, "enum value", v.Name)
+				}
+			}
+		case *ast.Service:
+			c.define(scope, "service", n.Name)
+			if n.Body == nil || n.Name == nil {
+				continue
+			}
+			for _, m := range n.Body.List {
+				if rpc, ok := m.(*ast.RPC); ok {
+					c.define(join(scope, n.Name.Name), "rpc", rpc.Name)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package types
+
+import (
+	"github.com/kyleconroy/pb/ast"
+)
+
+// Field numbers must lie in [minField, maxField] and outside of the range
+// reserved for the protocol buffer implementation.
+const (
+	minField         = 1
+	maxField         = 1<<29 - 1
+	firstImplReserve = 19000
+	lastImplReserve  = 19999
+)
+
+// A numberRange is an inclusive range of numbers from a reserved statement.
+type numberRange struct {
+	low, high int64
+	node      *ast.Range
+}
+
+// fields returns the fields and groups in the body of a message, including
+// those declared in oneofs.
+func fields(body []ast.Node) []ast.Node {
+	var res []ast.Node
+	for _, node := range body {
+		switch n := node.(type) {
+		case *ast.MessageField, *ast.Group:
+			res = append(res, n)
+		case *ast.OneOf:
+			res = append(res, fields(n.Body)...)
+		}
+	}
+	return res
+}
+
+// fieldNumber returns the name and number literal of a field or group.
+func fieldNumber(field ast.Node) (*ast.Ident, *ast.BasicLit) {
+	switch f := field.(type) {
+	case *ast.MessageField:
+		return f.Name, f.Number
+	case *ast.Group:
+		return f.Name, f.Number
+	}
+	return nil, nil
+}
+
+// reservedRanges returns the number ranges reserved in body. The high end
+// of max is limit.
+func reservedRanges(body []ast.Node, limit int64) []numberRange {
+	var ranges []numberRange
+	for _, node := range body {
+		res, ok := node.(*ast.Reserved)
+		if !ok {
+			continue
+		}
+		for _, r := range res.Ranges {
+			low, ok := intValue(r.Low.Decoded)
+			if !ok {
+				continue
+			}
+			high := low
+			switch h := r.High.(type) {
+			case *ast.BasicLit:
+				if high, ok = intValue(h.Decoded); !ok {
+					continue
+				}
+			case *ast.Ident:
+				high = limit
+			}
+			ranges = append(ranges, numberRange{low, high, r})
+		}
+	}
+	return ranges
+}
+
+// checkNumbers reports field numbers in the body of a message that are out
+// of range, reserved, or used by more than one field.
+func (c *checker) checkNumbers(body []ast.Node) {
+	reserved := reservedRanges(body, maxField)
+	seen := map[int64]*ast.BasicLit{}
+	for _, field := range fields(body) {
+		name, lit := fieldNumber(field)
+		if name == nil || lit == nil {
+			continue
+		}
+		num, ok := intValue(lit.Decoded)
+		if !ok {
+			continue
+		}
+		switch {
+		case num < minField || num > maxField:
+			c.errorf(lit.Pos(), "field number %d of %s out of range [%d, %d]", num, name.Name, minField, maxField)
+			continue
+		case firstImplReserve <= num && num <= lastImplReserve:
+			c.errorf(lit.Pos(), "field number %d of %s is reserved for the protocol buffer implementation (%d to %d)", num, name.Name, firstImplReserve, lastImplReserve)
+		}
+		if prev, ok := seen[num]; ok {
+			c.errorf(lit.Pos(), "field number %d of %s already used at %s", num, name.Name, c.fset.Position(prev.Pos()))
+		} else {
+			seen[num] = lit
+		}
+		for _, r := range reserved {
+			if r.low <= num && num <= r.high {
+				c.errorf(lit.Pos(), "field number %d of %s is reserved at %s", num, name.Name, c.fset.Position(r.node.Pos()))
+				break
+			}
+		}
+	}
+}
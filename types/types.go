@@ -0,0 +1,398 @@
+// Package types resolves the type references of parsed proto files to the
+// messages and enums they denote.
+//
+// Names are resolved like protoc does: a relative name such as Foo.Bar used
+// inside message a.b.Msg is looked up in a.b.Msg, a.b, a and finally the
+// root scope, using the first scope that declares Foo. A name with a
+// leading dot is fully qualified. Only declarations in the file itself and
+// in the files it can see through its imports are considered.
+//
+// Check also reports semantic errors the parser accepts, such as field
+// numbers used twice in the same message or names declared twice in the
+// same scope.
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kyleconroy/pb/ast"
+	"github.com/kyleconroy/pb/importer"
+	"github.com/kyleconroy/pb/parser"
+	"github.com/kyleconroy/pb/token"
+)
+
+// ObjKind describes what an object represents.
+type ObjKind int
+
+// The list of possible Object kinds.
+const (
+	Bad  ObjKind = iota // for error handling
+	Pkg                 // package, or a parent of one
+	Msg                 // message or group
+	Enum                // enum
+)
+
+var objKindStrings = [...]string{
+	Bad:  "bad",
+	Pkg:  "package",
+	Msg:  "message",
+	Enum: "enum",
+}
+
+func (kind ObjKind) String() string { return objKindStrings[kind] }
+
+// An Object describes a named package, message, group or enum.
+type Object struct {
+	Kind     ObjKind
+	Name     string         // declared name, e.g. Bar
+	FullName string         // fully qualified name without leading dot, e.g. foo.Bar
+	Decl     ast.Node       // *ast.Message, *ast.Group or *ast.Enum; nil for packages
+	File     *importer.File // declaring file; nil for packages
+
+	files []*importer.File // files declaring the package, if Kind is Pkg
+}
+
+// Pos returns the position of the declared name, or token.NoPos for a
+// package.
+func (obj *Object) Pos() token.Pos {
+	switch d := obj.Decl.(type) {
+	case *ast.Message:
+		return d.Name.Pos()
+	case *ast.Group:
+		return d.Name.Pos()
+	case *ast.Enum:
+		return d.Name.Pos()
+	}
+	return token.NoPos
+}
+
+// Info holds the results of type checking.
+type Info struct {
+	// Defs maps the names of declared messages, groups and enums to the
+	// objects they declare.
+	Defs map[*ast.Ident]*Object
+
+	// Uses maps type references to the objects they denote. References
+	// are the *ast.Ident or *ast.FullIdent nodes in the Type of fields,
+	// the Value of map types, the Type of extend blocks and the InType
+	// and OutType of rpcs. Scalar types are not recorded.
+	Uses map[ast.Node]*Object
+}
+
+// ObjectOf returns the object declared or denoted by n, or nil if there is
+// none.
+func (info *Info) ObjectOf(n ast.Node) *Object {
+	if id, ok := n.(*ast.Ident); ok {
+		if obj := info.Defs[id]; obj != nil {
+			return obj
+		}
+	}
+	return info.Uses[n]
+}
+
+// Check resolves the type references in files, which must include every
+// file they import, such as the files returned by an importer.Importer.
+//
+// Check returns the resolved references together with a parser.ErrorList
+// describing undefined and ambiguous references and semantic errors, such
+// as conflicting field numbers, if any.
+func Check(fset *token.FileSet, files []*importer.File) (*Info, error) {
+	c := checker{
+		fset: fset,
+		info: &Info{
+			Defs: map[*ast.Ident]*Object{},
+			Uses: map[ast.Node]*Object{},
+		},
+		objects: map[string][]*Object{},
+		names:   map[string]symbol{},
+		visible: map[*importer.File]map[*importer.File]bool{},
+	}
+	for _, f := range files {
+		c.collect(f)
+		c.defineNames(f)
+	}
+	for _, f := range files {
+		c.resolveBody(f, f.AST.PackageName(), f.AST.Nodes)
+		c.validate(f.AST, f.AST.Nodes)
+	}
+	c.errors.Sort()
+	return c.info, c.errors.Err()
+}
+
+// A checker holds the state of a single call to Check.
+type checker struct {
+	fset    *token.FileSet
+	info    *Info
+	objects map[string][]*Object // declarations by full name
+	names   map[string]symbol    // all declared names by full name
+	visible map[*importer.File]map[*importer.File]bool
+	errors  parser.ErrorList
+}
+
+func (c *checker) errorf(pos token.Pos, format string, args ...interface{}) {
+	c.errors.Add(c.fset.Position(pos), fmt.Sprintf(format, args...))
+}
+
+// join returns the full name of name declared in scope.
+func join(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// collect declares the package and the types of file f.
+func (c *checker) collect(f *importer.File) {
+	visible := map[*importer.File]bool{f: true}
+	for _, dep := range f.Visible() {
+		visible[dep] = true
+	}
+	c.visible[f] = visible
+
+	if pkg := f.AST.PackageName(); pkg != "" {
+		scope := ""
+		for _, name := range strings.Split(pkg, ".") {
+			scope = join(scope, name)
+			obj := c.pkg(scope, name)
+			obj.files = append(obj.files, f)
+		}
+	}
+	c.collectBody(f, f.AST.PackageName(), f.AST.Nodes)
+}
+
+// pkg returns the package object with the given full name, creating it if
+// necessary.
+func (c *checker) pkg(fullName, name string) *Object {
+	for _, obj := range c.objects[fullName] {
+		if obj.Kind == Pkg {
+			return obj
+		}
+	}
+	obj := &Object{Kind: Pkg, Name: name, FullName: fullName}
+	c.objects[fullName] = append(c.objects[fullName], obj)
+	return obj
+}
+
+// collectBody declares the types in body, which belongs to scope.
+func (c *checker) collectBody(f *importer.File, scope string, body []ast.Node) {
+	for _, node := range body {
+		switch n := node.(type) {
+		case *ast.Message:
+			obj := c.declare(f, scope, Msg, n.Name, n)
+			c.collectBody(f, obj.FullName, n.Body)
+		case *ast.Group:
+			obj := c.declare(f, scope, Msg, n.Name, n)
+			c.collectBody(f, obj.FullName, n.Body)
+		case *ast.Enum:
+			c.declare(f, scope, Enum, n.Name, n)
+		case *ast.OneOf:
+			c.collectBody(f, scope, n.Body)
+		case *ast.Extend:
+			c.collectBody(f, scope, n.Body)
+		}
+	}
+}
+
+func (c *checker) declare(f *importer.File, scope string, kind ObjKind, name *ast.Ident, decl ast.Node) *Object {
+	obj := &Object{
+		Kind:     kind,
+		Name:     name.Name,
+		FullName: join(scope, name.Name),
+		Decl:     decl,
+		File:     f,
+	}
+	c.objects[obj.FullName] = append(c.objects[obj.FullName], obj)
+	c.info.Defs[name] = obj
+	return obj
+}
+
+// resolveBody resolves the type references in body, which belongs to
+// scope.
+func (c *checker) resolveBody(f *importer.File, scope string, body []ast.Node) {
+	for _, node := range body {
+		switch n := node.(type) {
+		case *ast.Message:
+			c.resolveBody(f, join(scope, n.Name.Name), n.Body)
+		case *ast.Group:
+			c.resolveBody(f, join(scope, n.Name.Name), n.Body)
+		case *ast.OneOf:
+			c.resolveBody(f, scope, n.Body)
+		case *ast.Extend:
+			if obj := c.resolve(f, scope, n.Type, n.Type.Pos()); obj != nil && obj.Kind != Msg {
+				c.errorf(n.Type.Pos(), "%s is not a message", obj.FullName)
+			}
+			c.resolveBody(f, scope, n.Body)
+		case *ast.MessageField:
+			// Errors in the value of a map are reported at the map keyword
+			typ, pos := n.Type, n.Type.Pos()
+			if m, ok := typ.(*ast.MapType); ok {
+				typ, pos = m.Value, m.Map
+			}
+			if id, ok := typ.(*ast.Ident); ok && isScalar(id.Name) {
+				continue
+			}
+			if obj := c.resolve(f, scope, typ, pos); obj != nil && obj.Kind == Pkg {
+				c.errorf(pos, "%s is not a type", obj.FullName)
+			}
+		case *ast.Service:
+			if n.Body == nil {
+				continue
+			}
+			for _, m := range n.Body.List {
+				rpc, ok := m.(*ast.RPC)
+				if !ok {
+					continue
+				}
+				for _, typ := range []ast.Node{rpc.InType, rpc.OutType} {
+					if obj := c.resolve(f, scope, typ, typ.Pos()); obj != nil && obj.Kind != Msg {
+						c.errorf(typ.Pos(), "%s is not a message", obj.FullName)
+					}
+				}
+			}
+		}
+	}
+}
+
+// resolve looks up the type reference ref, made in scope of file f, and
+// records the object it denotes. It reports an error at pos and returns
+// nil if the reference can't be resolved.
+func (c *checker) resolve(f *importer.File, scope string, ref ast.Node, pos token.Pos) *Object {
+	var parts []string
+	absolute := false
+	switch ref := ref.(type) {
+	case *ast.Ident:
+		parts = []string{ref.Name}
+	case *ast.FullIdent:
+		for _, p := range ref.Parts {
+			parts = append(parts, p.Name)
+		}
+		absolute = ref.Absolute
+	default:
+		return nil
+	}
+	name := strings.Join(parts, ".")
+	if absolute {
+		scope = ""
+		name = "." + name
+	}
+
+	var hidden, pkg *Object
+	for s := scope; ; s = parent(s) {
+		objs, h := c.lookup(f, join(s, parts[0]))
+		if hidden == nil {
+			hidden = h
+		}
+		if len(parts) == 1 {
+			// A single name only denotes a type, never a package
+			if len(objs) > 0 && pkg == nil {
+				pkg = objs[0]
+			}
+			objs = types(objs)
+		}
+		if len(objs) > 0 {
+			if len(parts) > 1 {
+				full := join(s, strings.Join(parts, "."))
+				if objs, h = c.lookup(f, full); len(objs) == 0 {
+					if h != nil {
+						c.hiddenError(pos, name, h)
+					} else {
+						c.errorf(pos, "undefined: %s (resolved to %s, which is not defined)", name, full)
+					}
+					return nil
+				}
+			}
+			if len(objs) > 1 {
+				c.errorf(pos, "ambiguous reference %s: declared at %s and %s", name, c.fset.Position(objs[0].Pos()), c.fset.Position(objs[1].Pos()))
+				return nil
+			}
+			c.info.Uses[ref] = objs[0]
+			return objs[0]
+		}
+		if s == "" || absolute {
+			break
+		}
+	}
+	switch {
+	case hidden != nil:
+		c.hiddenError(pos, name, hidden)
+	case pkg != nil:
+		c.errorf(pos, "%s is not a type", pkg.FullName)
+	default:
+		c.errorf(pos, "undefined: %s", name)
+	}
+	return nil
+}
+
+func (c *checker) hiddenError(pos token.Pos, name string, obj *Object) {
+	c.errorf(pos, "undefined: %s (%s is declared in %s, which is not imported)", name, obj.FullName, obj.File.Path)
+}
+
+// lookup returns the objects with the given full name that are visible
+// from file f, and one that isn't, if any.
+func (c *checker) lookup(f *importer.File, fullName string) (objs []*Object, hidden *Object) {
+	visible := c.visible[f]
+	for _, obj := range c.objects[fullName] {
+		switch {
+		case obj.Kind == Pkg && visibleIn(obj.files, visible):
+			objs = append(objs, obj)
+		case obj.Kind != Pkg && visible[obj.File]:
+			objs = append(objs, obj)
+		case obj.Kind != Pkg && hidden == nil:
+			hidden = obj
+		}
+	}
+	return objs, hidden
+}
+
+// visibleIn reports whether any of files is visible.
+func visibleIn(files []*importer.File, visible map[*importer.File]bool) bool {
+	for _, f := range files {
+		if visible[f] {
+			return true
+		}
+	}
+	return false
+}
+
+// types returns the objects in objs that aren't packages.
+func types(objs []*Object) []*Object {
+	var res []*Object
+	for _, obj := range objs {
+		if obj.Kind != Pkg {
+			res = append(res, obj)
+		}
+	}
+	return res
+}
+
+// parent returns the scope enclosing scope.
+func parent(scope string) string {
+	if i := strings.LastIndex(scope, "."); i >= 0 {
+		return scope[:i]
+	}
+	return ""
+}
+
+var scalars = map[string]bool{
+	"double":   true,
+	"float":    true,
+	"int32":    true,
+	"int64":    true,
+	"uint32":   true,
+	"uint64":   true,
+	"sint32":   true,
+	"sint64":   true,
+	"fixed32":  true,
+	"fixed64":  true,
+	"sfixed32": true,
+	"sfixed64": true,
+	"bool":     true,
+	"string":   true,
+	"bytes":    true,
+}
+
+// isScalar reports whether name is one of the scalar value types.
+func isScalar(name string) bool {
+	return scalars[name]
+}
@@ -0,0 +1,395 @@
+package types
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kyleconroy/pb/ast"
+	"github.com/kyleconroy/pb/importer"
+	"github.com/kyleconroy/pb/parser"
+	"github.com/kyleconroy/pb/token"
+	"github.com/kyleconroy/pb/wellknown"
+)
+
+// check imports the first of the given files, which are served from
+// memory, and type checks everything it imports.
+func check(t *testing.T, files map[string]string, root string) ([]*importer.File, *Info, []string) {
+	fsys := fstest.MapFS{}
+	for name, src := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(src)}
+	}
+	fset := token.NewFileSet()
+	imp := importer.New(fset, nil, 0)
+	imp.Builtin = fsys
+	pfiles, err := imp.Import(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := Check(fset, pfiles)
+	var msgs []string
+	if list, ok := err.(parser.ErrorList); ok {
+		for _, e := range list {
+			msgs = append(msgs, e.Error())
+		}
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return pfiles, info, msgs
+}
+
+func expectErrors(t *testing.T, errs, expected []string) {
+	t.Helper()
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+}
+
+// fieldTypes returns the full names of the types of the fields in f, in
+// source order, as name=type pairs.
+func fieldTypes(f *importer.File, info *Info) string {
+	var pairs []string
+	ast.Walk(visitor(func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.MessageField:
+			typ := n.Type
+			if m, ok := typ.(*ast.MapType); ok {
+				typ = m.Value
+			}
+			if obj := info.ObjectOf(typ); obj != nil {
+				pairs = append(pairs, n.Name.Name+"="+obj.FullName)
+			}
+		case *ast.RPC:
+			for _, typ := range []ast.Node{n.InType, n.OutType} {
+				if obj := info.ObjectOf(typ); obj != nil {
+					pairs = append(pairs, n.Name.Name+"="+obj.FullName)
+				}
+			}
+		}
+	}), f.AST)
+	return strings.Join(pairs, " ")
+}
+
+type visitor func(ast.Node)
+
+func (v visitor) Visit(n ast.Node) ast.Visitor {
+	v(n)
+	return v
+}
+
+func TestResolve(t *testing.T) {
+	files, info, errs := check(t, map[string]string{
+		"foo/app.proto": `syntax = "proto2";
+package foo.app;
+import "foo/lib.proto";
+
+message Outer {
+  message Inner {
+    optional Kind kind = 1;
+    optional Inner self = 2;
+  }
+  enum Kind { A = 0; }
+  optional Inner inner = 1;
+  optional lib.Lib a = 2;
+  optional foo.lib.Lib b = 3;
+  optional .foo.lib.Lib.Nested c = 4;
+  map<string, Outer.Inner> d = 5;
+  optional group Result = 6 {
+    optional Result again = 1;
+  }
+  optional Shared e = 7;
+  optional int32 f = 8;
+}
+
+service Svc {
+  rpc Get (Outer) returns (lib.Lib.Nested);
+}`,
+		"foo/lib.proto": `syntax = "proto2";
+package foo.lib;
+import public "shared.proto";
+message Lib { message Nested {} }`,
+		"shared.proto": `syntax = "proto2";
+message Shared {}`,
+	}, "foo/app.proto")
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors:\n%s", strings.Join(errs, "\n"))
+	}
+
+	expected := "kind=foo.app.Outer.Kind self=foo.app.Outer.Inner inner=foo.app.Outer.Inner " +
+		"a=foo.lib.Lib b=foo.lib.Lib c=foo.lib.Lib.Nested d=foo.app.Outer.Inner " +
+		"again=foo.app.Outer.Result e=Shared Get=foo.app.Outer Get=foo.lib.Lib.Nested"
+	app := files[len(files)-1]
+	if types := fieldTypes(app, info); types != expected {
+		t.Errorf("expected %s\ngot      %s", expected, types)
+	}
+
+	var msg *ast.Message
+	for _, n := range app.AST.Nodes {
+		if m, ok := n.(*ast.Message); ok {
+			msg = m
+		}
+	}
+	if obj := info.ObjectOf(msg.Name); obj == nil || obj.Kind != Msg || obj.FullName != "foo.app.Outer" || obj.File != app {
+		t.Errorf("unexpected object for Outer: %+v", obj)
+	}
+}
+
+func TestResolveInnermostScope(t *testing.T) {
+	// Inner.Kind resolves Inner in the innermost scope declaring it, even
+	// though only the outer Inner declares Kind.
+	_, _, errs := check(t, map[string]string{
+		"a.proto": `syntax = "proto3";
+package a;
+message Inner { enum Kind { A = 0; } }
+message Outer {
+  message Inner {}
+  Inner.Kind kind = 1;
+  .a.Inner.Kind ok = 2;
+}`,
+	}, "a.proto")
+	expected := []string{
+		"a.proto:6:3: undefined: Inner.Kind (resolved to a.Outer.Inner.Kind, which is not defined)",
+	}
+	expectErrors(t, errs, expected)
+}
+
+func TestResolveErrors(t *testing.T) {
+	_, _, errs := check(t, map[string]string{
+		"a.proto": `syntax = "proto3";
+package a;
+import "b.proto";
+import "c.proto";
+message M {
+  Missing x = 1;
+  Hidden y = 2;
+  b.Dup z = 3;
+  a w = 4;
+  map<string, .b> v = 5;
+  E.Value u = 6;
+}
+enum E { ZERO = 0; }
+service S {
+  rpc Get (E) returns (M);
+}
+extend E {}`,
+		"b.proto": `syntax = "proto3";
+package b;
+import "hidden.proto";
+message Dup {}`,
+		"c.proto": `syntax = "proto3";
+package b;
+message Dup {}`,
+		"hidden.proto": `syntax = "proto3";
+package a;
+message Hidden {}`,
+	}, "a.proto")
+	expected := []string{
+		"a.proto:6:3: undefined: Missing",
+		"a.proto:7:3: undefined: Hidden (a.Hidden is declared in hidden.proto, which is not imported)",
+		"a.proto:8:3: ambiguous reference b.Dup: declared at b.proto:4:9 and c.proto:3:9",
+		"a.proto:9:3: a is not a type",
+		"a.proto:10:3: b is not a type",
+		"a.proto:11:3: undefined: E.Value (resolved to a.E.Value, which is not defined)",
+		"a.proto:15:12: a.E is not a message",
+		"a.proto:17:8: a.E is not a message",
+		"c.proto:3:9: message b.Dup already declared at b.proto:4:9",
+	}
+	expectErrors(t, errs, expected)
+}
+
+func TestResolveWellKnown(t *testing.T) {
+	fset := token.NewFileSet()
+	imp := importer.New(fset, nil, 0)
+	files, err := imp.Import("google/protobuf/api.proto", "google/protobuf/compiler/plugin.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Check(fset, files); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestResolveCustomOptions(t *testing.T) {
+	descriptor, err := fs.ReadFile(wellknown.FS, "google/protobuf/descriptor.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, info, errs := check(t, map[string]string{
+		"opts.proto": `syntax = "proto3";
+package opts;
+import "google/protobuf/descriptor.proto";
+extend google.protobuf.FieldOptions { string label = 50000; }
+message Msg { string name = 1 [(label) = "Name"]; }`,
+		"google/protobuf/descriptor.proto": string(descriptor),
+	}, "opts.proto")
+	expectErrors(t, errs, nil)
+	ext := files[len(files)-1].AST.Nodes[2].(*ast.Extend)
+	if obj := info.ObjectOf(ext.Type); obj == nil || obj.FullName != "google.protobuf.FieldOptions" {
+		t.Errorf("expected google.protobuf.FieldOptions, got %v", obj)
+	}
+}
+
+func TestFieldNumbers(t *testing.T) {
+	_, _, errs := check(t, map[string]string{
+		"a.proto": `syntax = "proto2";
+message M {
+  repeated int64 foooozy = 4;
+  map<int32, string> my_map = 4;
+  optional int32 zero = 0;
+  optional int32 big = 536870912;
+  optional int32 impl = 19000;
+  optional int32 max = 536870911;
+  oneof o {
+    string name = 0x4;
+    group G = 5 {
+      optional int32 inner = 4;
+    }
+  }
+  optional int32 res = 10;
+  optional int32 high = 1000;
+  reserved 2, 9 to 11, 1000 to 2000, 100000 to max;
+}`,
+	}, "a.proto")
+	expectErrors(t, errs, []string{
+		"a.proto:4:31: field number 4 of my_map already used at a.proto:3:28",
+		"a.proto:5:25: field number 0 of zero out of range [1, 536870911]",
+		"a.proto:6:24: field number 536870912 of big out of range [1, 536870911]",
+		"a.proto:7:25: field number 19000 of impl is reserved for the protocol buffer implementation (19000 to 19999)",
+		"a.proto:8:24: field number 536870911 of max is reserved at a.proto:17:38",
+		"a.proto:10:19: field number 4 of name already used at a.proto:3:28",
+		"a.proto:15:24: field number 10 of res is reserved at a.proto:17:15",
+		"a.proto:16:25: field number 1000 of high is reserved at a.proto:17:24",
+	})
+}
+
+func TestNames(t *testing.T) {
+	_, _, errs := check(t, map[string]string{
+		"a.proto": `syntax = "proto2";
+package a;
+import "b.proto";
+message M {
+  optional int32 name = 1;
+  optional string name = 2;
+  oneof choice {
+    int32 other = 3;
+    int32 choice = 4;
+  }
+  optional group Result = 5 {}
+  optional int32 result = 6;
+  message Result {}
+  enum Kind { UNKNOWN = 0; }
+  enum Status { UNKNOWN = 0; }
+}
+enum Kind { UNKNOWN = 0; }
+enum Status { UNKNOWN = 0; }
+service S {
+  rpc Get (M) returns (M);
+  rpc Get (M) returns (M);
+}
+message S {}
+message b {}`,
+		"b.proto": `syntax = "proto2";
+package a.b;`,
+	}, "a.proto")
+	expectErrors(t, errs, []string{
+		"a.proto:6:19: field a.M.name already declared at a.proto:5:18",
+		"a.proto:9:11: field a.M.choice already declared at a.proto:7:9",
+		"a.proto:12:18: field a.M.result already declared at a.proto:11:18",
+		"a.proto:13:11: message a.M.Result already declared at a.proto:11:18",
+		"a.proto:15:17: enum value a.M.UNKNOWN already declared at a.proto:14:15 (enum values are siblings of their enum, not children of it)",
+		"a.proto:18:15: enum value a.UNKNOWN already declared at a.proto:17:13 (enum values are siblings of their enum, not children of it)",
+		"a.proto:21:7: rpc a.S.Get already declared at a.proto:20:7",
+		"a.proto:23:9: message a.S already declared at a.proto:19:9",
+		"a.proto:24:9: message a.b already declared at b.proto:2:11",
+	})
+}
+
+func TestEnums(t *testing.T) {
+	_, _, errs := check(t, map[string]string{
+		"a.proto": `syntax = "proto3";
+enum NotZero {
+  ONE = 1;
+  ZERO = 0;
+}
+enum Aliases {
+  option allow_alias = true;
+  A = 0;
+  B = 0;
+}
+enum NeedlessAlias {
+  option allow_alias = true;
+  C = 0;
+  D = 1;
+}
+enum Duplicate {
+  E = 0;
+  F = 0x0;
+}
+enum Reserved {
+  G = 0;
+  H = 2;
+  I = 2147483647;
+  FOO = 20;
+  reserved 2, 10 to max;
+  reserved "FOO";
+}
+enum Empty {
+  reserved 1;
+}`,
+	}, "a.proto")
+	expectErrors(t, errs, []string{
+		"a.proto:3:9: first value of enum NotZero must be zero in proto3",
+		"a.proto:12:3: enum NeedlessAlias sets allow_alias, but no values share a number",
+		"a.proto:18:7: value 0 of F already used by E at a.proto:17:7 (set option allow_alias = true to allow aliases)",
+		"a.proto:22:7: value 2 of H is reserved at a.proto:25:12",
+		"a.proto:23:7: value 2147483647 of I is reserved at a.proto:25:15",
+		"a.proto:24:3: name FOO is reserved at a.proto:26:12",
+		"a.proto:24:9: value 20 of FOO is reserved at a.proto:25:15",
+		"a.proto:28:6: enum Empty must contain at least one value",
+	})
+
+	// Editions reserve names with identifiers
+	_, _, errs = check(t, map[string]string{
+		"b.proto": `edition = "2023";
+enum E {
+  E_UNKNOWN = 0;
+  BAR = 1;
+  reserved BAR;
+}`,
+	}, "b.proto")
+	expectErrors(t, errs, []string{
+		"b.proto:4:3: name BAR is reserved at b.proto:5:12",
+	})
+}
+
+func TestMaps(t *testing.T) {
+	_, _, errs := check(t, map[string]string{
+		"a.proto": `syntax = "proto2";
+enum E { ZERO = 0; }
+message M {
+  map<string, M> ok = 1;
+  map<sfixed64, E> also_ok = 2;
+  map<float, string> f = 3;
+  map<bytes, string> b = 4;
+  map<E, string> e = 5;
+  map<M, string> m = 6;
+  repeated map<int32, string> r = 7;
+  optional map<int32, string> o = 8;
+  map<int32, Missing> v = 9;
+  oneof choice {
+    map<int32, string> in_oneof = 10;
+  }
+}`,
+	}, "a.proto")
+	expectErrors(t, errs, []string{
+		"a.proto:6:3: invalid key type float of map field f; keys must be integral, bool or string",
+		"a.proto:7:3: invalid key type bytes of map field b; keys must be integral, bool or string",
+		"a.proto:8:3: invalid key type E of map field e; keys must be integral, bool or string",
+		"a.proto:9:3: invalid key type M of map field m; keys must be integral, bool or string",
+		"a.proto:10:12: map field r cannot be repeated",
+		"a.proto:11:12: map field o cannot be optional",
+		"a.proto:12:3: undefined: Missing",
+		"a.proto:14:5: map field in_oneof cannot be in a oneof",
+	})
+}
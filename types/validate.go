@@ -0,0 +1,40 @@
+package types
+
+import (
+	"strconv"
+
+	"github.com/kyleconroy/pb/ast"
+)
+
+// validate reports semantic errors in the declarations in body, which
+// belongs to file f, descending into nested messages, groups and extend
+// blocks.
+func (c *checker) validate(f *ast.File, body []ast.Node) {
+	for _, node := range body {
+		switch n := node.(type) {
+		case *ast.Message:
+			c.checkNumbers(n.Body)
+			c.validate(f, n.Body)
+		case *ast.Group:
+			c.checkNumbers(n.Body)
+			c.validate(f, n.Body)
+		case *ast.OneOf:
+			c.checkOneOfMaps(n)
+			c.validate(f, n.Body)
+		case *ast.Extend:
+			c.validate(f, n.Body)
+		case *ast.Enum:
+			c.checkEnum(f, n)
+		case *ast.MessageField:
+			if m, ok := n.Type.(*ast.MapType); ok {
+				c.checkMap(n, m)
+			}
+		}
+	}
+}
+
+// intValue returns the value of an integer literal.
+func intValue(lit string) (int64, bool) {
+	v, err := strconv.ParseInt(lit, 0, 64)
+	return v, err == nil
+}
@@ -0,0 +1,13 @@
+// Package wellknown embeds the well-known types of protocol buffers, such
+// as google/protobuf/timestamp.proto, along with the descriptor and plugin
+// types that option definitions and protoc plugins import, so that imports
+// of them resolve without protoc's include directory.
+package wellknown
+
+import "embed"
+
+// FS holds the well-known type files under their import paths, e.g.
+// google/protobuf/any.proto.
+//
+//go:embed google/protobuf/*.proto google/protobuf/compiler/*.proto
+var FS embed.FS